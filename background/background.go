@@ -8,15 +8,23 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
 	"unisync/config"
+	"unisync/control"
+	"unisync/log"
 
 	"github.com/shirou/gopsutil/v3/process"
 )
 
 var childEnv = "__UNISYNC_CHILD"
 
+// how long -stop waits for a graceful exit before killing the process
+// should be longer than session.StopTimeout
+var stopTimeout = 30 * time.Second
+
 func pidFileName(name string) string {
 	return filepath.Join(config.ConfigDir(), name+".pid")
 }
@@ -25,6 +33,15 @@ func IsChild() bool {
 	return os.Getenv(childEnv) != ""
 }
 
+// Detach lets the -start runner know it can exit and leave us running in the background
+// if we don't close stdout, Unix produces SIGPIPE when we next try to write to it
+// unfortunately os.Stderr can't be closed because of a potential issue in go (see go "os" docs)
+// but that's okay because we'll never use os.Stderr
+func Detach() {
+	log.ScreenOutput = nil
+	os.Stdout.Close()
+}
+
 func WritePid(name string) error {
 	if name == "" {
 		panic("WritePid(name) -- name can't be blank")
@@ -99,15 +116,44 @@ func Stop(name string) error {
 	if err != nil {
 		return err
 	}
-	if err = proc.Kill(); err != nil {
-		return err
+
+	// ask nicely first, so it can finish the file it's transferring
+	// windows has no SIGTERM, so the control socket is the only nice way there
+	if err := control.Send(name, &control.Request{Cmd: "stop"}, nil); err != nil {
+		if runtime.GOOS == "windows" {
+			err = proc.Kill()
+		} else {
+			err = proc.Terminate()
+		}
+		if err != nil {
+			return err
+		}
 	}
-	if err = os.Remove(pidFileName(name)); err != nil {
-		return fmt.Errorf("Unable to remove pid file:", err)
+
+	if !waitForExit(proc, stopTimeout) {
+		if err = proc.Kill(); err != nil {
+			return err
+		}
+	}
+
+	if err = os.Remove(pidFileName(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("Unable to remove pid file: %v", err)
 	}
 	return nil
 }
 
+func waitForExit(proc *process.Process, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if isRunning, err := proc.IsRunning(); err == nil && !isRunning {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return false
+}
+
 func ListRunning() []string {
 	names := []string{}
 
@@ -180,8 +226,6 @@ func Start(name string) error {
 		}
 		return nil
 	}
-
-	return nil
 }
 
 // like (*os.Process).Wait(), except returns on a channel
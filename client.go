@@ -1,100 +1,172 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"time"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"unisync/background"
-	"unisync/client"
 	"unisync/config"
+	"unisync/control"
 	"unisync/log"
-	"unisync/transports/externalssh"
-	"unisync/transports/internalssh"
-	"unisync/transports/tlsclient"
+	"unisync/metrics"
+	"unisync/notifier"
+	"unisync/service"
+	"unisync/session"
 )
 
-func runClient(conf *config.Config) {
-	// auto-retry only if our first try managed to fully connect and sync
-	retryTime := 5 * time.Second
-	everConnected := false
+// exit codes, so that scripts using -once can tell what happened
+// 2 is left out, it's what the flag package exits with on a usage error
+const (
+	exitOk          = 0
+	exitFailed      = 1
+	exitConflicts   = 3
+	exitMaxDelete   = 4
+	exitInterrupted = 5
+	exitSynced      = 6
+)
 
-	for {
-		connected, err := _runClient(conf)
-		if connected {
-			everConnected = true
-		}
+// returns the exit code, any error has already been logged
+func runClient(conf *config.Config) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := func() {
+		log.Println("Stopping..")
+		service.Stopping()
+		cancel()
+	}
+	stopOnSignal(stop)
 
-		if err != nil {
-			log.Warnln("Client disconnected:", err)
+	if conf.MetricsListen != "" {
+		if err := metrics.Serve(conf.MetricsListen); err != nil {
+			log.Warnln(err)
+			return exitFailed
 		}
-		if err == nil || !everConnected {
-			return
-		}
-
-		log.Printf("Retrying in %v..", retryTime)
-		time.Sleep(retryTime)
 	}
-}
-
-func _runClient(conf *config.Config) (bool, error) {
-	var in io.Reader
-	var out io.Writer
-	var err error
 
-	if conf.Method == "directtls" {
-		log.Printf("Connecting to %v:%v (%v)", conf.Host, conf.Port, conf.Method)
-	} else {
-		log.Printf("Connecting to %v@%v (%v)", conf.User, conf.Host, conf.Method)
+	s := session.New(conf)
+	s.Background = background.IsChild()
+	// started before the network is up, say
+	s.Unattended = service.IsService()
+	handlePauseSignals(s)
+	reopenLogOnSignal(conf)
+
+	notifier := notifier.New(conf)
+	if notifier != nil {
+		// -once and stopping exit right after, which would cut the last notifications off
+		defer notifier.Close()
 	}
 
-	if conf.Method == "internalssh" {
-		sshclient, err := internalssh.New(conf)
-		if err != nil {
-			return false, err
+	// when running as a systemd service, tell it once we're up and keep its watchdog happy
+	var ready sync.Once
+	conflicts, maxDelete := false, false
+	s.OnEvent = func(event session.Event) {
+		switch event.Type {
+		case session.EventSynced:
+			ready.Do(func() { service.Ready() })
+		case session.EventConflict:
+			conflicts = true
+		case session.EventMaxDelete:
+			maxDelete = true
+		}
+		if notifier != nil {
+			notifier.Handle(event)
 		}
-		defer sshclient.Close()
+	}
+	if interval := service.WatchdogInterval(); interval > 0 {
+		s.Watchdog = func() { service.Watchdog() }
+		s.WatchdogInterval = interval
+	}
 
-		out, in, err = sshclient.Run()
+	// nameless configs can't be looked up by name, so there's no point
+	if conf.Name != "" {
+		listener, err := control.Listen(conf.Name, controlHandler(s, stop))
 		if err != nil {
-			return false, fmt.Errorf("ssh error: %v", err)
+			log.Warnln("Unable to start control socket:", err)
+		} else {
+			defer listener.Close()
 		}
+	}
 
-	} else if conf.Method == "ssh" {
+	if err := s.Run(ctx); err != nil {
+		return exitFailed
+	}
 
-		sshclient := externalssh.New(conf)
-		defer func() {
-			err := sshclient.Close()
-			if err != nil {
-				log.Warnln("ssh client exited:", err)
-			}
-		}()
-		out, in, err = sshclient.Run()
-		if err != nil {
-			return false, fmt.Errorf("ssh error: %v", err)
-		}
+	// when watching, stopping is how it's supposed to end
+	if conf.WatchLocal != "0" || conf.WatchRemote != "0" {
+		return exitOk
+	}
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case maxDelete:
+		return exitMaxDelete
+	case conflicts:
+		return exitConflicts
+	case s.Status().Totals.Changed():
+		return exitSynced
+	}
+	return exitOk
+}
 
-	} else if conf.Method == "directtls" {
+// the first Ctrl-C (or -stop) lets the current transfer finish, a second one exits right away
+func stopOnSignal(stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-		cert, capool, err := getCert(conf.TlsKey, false)
-		if err != nil {
-			return false, err
-		}
-		tlsc := tlsclient.New(conf, cert, capool)
-		defer tlsc.Close()
+	go func() {
+		<-c
+		signal.Stop(c)
+		stop()
+	}()
+}
 
-		out, in, err = tlsc.Run()
-		if err != nil {
-			return false, err
+func controlHandler(s *session.Session, stop func()) control.HandlerFn {
+	return func(req *control.Request) (any, error) {
+		switch req.Cmd {
+		case "status":
+			return s.Status(), nil
+		case "stop":
+			stop()
+		case "sync-now":
+			s.SyncNow()
+		case "pause":
+			s.Pause()
+		case "resume":
+			s.Resume()
+		case "bwlimit":
+			up, down, err := parseBwlimit(req.Arg)
+			if err != nil {
+				return nil, err
+			}
+			s.SetBwlimit(up, down)
+		default:
+			return nil, fmt.Errorf("invalid command %v", req.Cmd)
 		}
 
-	} else {
-		panic("conf.Method=" + conf.Method)
+		return nil, nil
+	}
+}
+
+// "UP:DOWN" in KB/s, or just one number for both
+func parseBwlimit(str string) (int, int, error) {
+	upStr, downStr, found := strings.Cut(str, ":")
+	if !found {
+		downStr = upStr
 	}
 
-	c, err := client.New(in, out, conf)
-	if err != nil {
-		return false, err
+	up, err := strconv.Atoi(strings.TrimSpace(upStr))
+	if err != nil || up < 0 {
+		return 0, 0, fmt.Errorf("invalid bwlimit %v, should be UP:DOWN in KB/s", str)
 	}
-	c.Background = background.IsChild()
-	return c.Run()
+	down, err := strconv.Atoi(strings.TrimSpace(downStr))
+	if err != nil || down < 0 {
+		return 0, 0, fmt.Errorf("invalid bwlimit %v, should be UP:DOWN in KB/s", str)
+	}
+
+	return up, down, nil
 }
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"os"
+	"sync"
+	"time"
+	"unisync/background"
 	"unisync/commands"
 	"unisync/config"
 	"unisync/filelist"
@@ -17,13 +20,39 @@ type Client struct {
 	Background     bool
 	cache          filelist.FileList
 	remoteBasepath string
+	remoteCaps     []string
+	syncC          chan struct{}
+	status         Status
+	statusLock     sync.Mutex
+
+	// what the current Sync() did so far, added to status.Totals when it's done
+	stats SyncStats
+
+	// see queueHooks(), can be shared with the next Client after a reconnect
+	// so changes from before it still get their hooks
+	PendingHooks *PendingHooks
+
+	// see checkMaxDelete(), guarded by statusLock
+	pausedForDeletes bool
+	deletesApproved  bool
+
+	// if set, called (from the goroutine running Run) for every file we
+	// push, pull or delete, and every conflict we resolve
+	OnEvent func(Event)
+
+	// if set, called at least every WatchdogInterval while Run is working
+	// normally, including during transfers, so a supervisor can tell if we hang
+	Watchdog         func()
+	WatchdogInterval time.Duration
+	lastWatchdog     time.Time
 }
 
 func New(in io.Reader, out io.Writer, config *config.Config) (*Client, error) {
 	n := node.New(in, out)
 	n.Config = config
-	n.SetSideC("FSEVENT", "PROGRESS")
-	client := &Client{Node: n}
+	n.SetSideC("FSEVENT", "PROGRESS", "OUTPUT", "PING", "PONG")
+	client := &Client{Node: n, syncC: make(chan struct{}, 1), PendingHooks: &PendingHooks{}}
+	n.SetBwlimit(int64(config.BwlimitUp)*1024, int64(config.BwlimitDown)*1024)
 
 	err := client.SetTmpdir(config.TmpdirLocal)
 	if err != nil {
@@ -43,13 +72,66 @@ func (c *Client) SideChannelReader() {
 		case "PROGRESS":
 			c.handlePROGRESS(packet.Command)
 
+		case "OUTPUT":
+			output := packet.Command.(*commands.Output)
+			log.Printf("[remote %v] %v", output.Name, output.Line)
+
+		case "PING", "PONG":
+			if err := c.HandleHeartbeat(packet.Command); err != nil {
+				c.SetDone(err)
+			}
+
 		default:
 			panic("invalid packet in SideC: " + cmdType)
 		}
 	}
 }
 
-func (c *Client) Run() (bool, error) {
+// asks Run() to sync right away, as if the watcher had seen a change
+func (c *Client) SyncNow() {
+	select {
+	case c.syncC <- struct{}{}:
+	default:
+	}
+}
+
+// while paused, we stay connected and keep watching, but don't sync
+// until Resume() is called
+func (c *Client) Pause() {
+	c.updateStatus(func(s *Status) { s.Paused = true })
+}
+
+// if we paused because of max_delete, resuming goes ahead with the deletes
+func (c *Client) Resume() {
+	c.statusLock.Lock()
+	c.status.Paused = false
+	if c.pausedForDeletes {
+		c.pausedForDeletes = false
+		c.deletesApproved = true
+	}
+	c.statusLock.Unlock()
+
+	c.SyncNow()
+}
+
+func (c *Client) isPaused() bool {
+	return c.Status().Paused
+}
+
+// SetBwlimit changes bwlimit_up and bwlimit_down (in KB/s, 0 for no limit) while we're connected
+// bwlimit_down is enforced by the server, so it returns an error if the server can't change it
+func (c *Client) SetBwlimit(up, down int) error {
+	c.Node.SetBwlimit(int64(up)*1024, int64(down)*1024)
+
+	if !commands.HasCap(c.remoteCaps, commands.CapBwlimit) {
+		return fmt.Errorf("the server can't change bwlimit_down until we reconnect")
+	}
+	return c.SendCmd(&commands.Bwlimit{Up: up, Down: down})
+}
+
+// Run returns once ctx is cancelled, after letting the file being transferred finish
+// to interrupt a transfer that's in progress, close the connection
+func (c *Client) Run(ctx context.Context) (bool, error) {
 	err := c.SetBasepath(c.Config.Local)
 	if err != nil {
 		return false, fmt.Errorf("Unable to set basepath: %w", err)
@@ -61,43 +143,99 @@ func (c *Client) Run() (bool, error) {
 	if err := c.RunHello(); err != nil {
 		return false, err
 	}
-	if err := c.Sync(); err != nil {
-		return false, err
+	// the cache is only found once we know the remote basepath
+	// another instance might be syncing into the same folder or tmpdir right now
+	if cache, err := c.Cache(); err == nil {
+		c.CleanTmpFiles(cache, time.Hour)
+	}
+	// if we're paused, Resume() will wake the loop below with SyncNow()
+	if !c.isPaused() {
+		if err := c.Sync(ctx); err != nil {
+			return false, err
+		}
+		if ctx.Err() != nil {
+			return true, nil
+		}
 	}
 
-	if c.Config.WatchLocal == "0" && c.Config.WatchRemote == "0" {
+	if c.runsOnce() {
+		if c.isPaused() {
+			// max_delete, and no one will be around to -resume
+			return true, nil
+		}
+		// nothing else is coming, so don't wait for hook_debounce
+		if err := c.RunPostSyncHooks(); err != nil {
+			return true, err
+		}
 		log.Printf("%v %v", "[X]", "Synced. All done..")
 		return true, nil
 	}
 
-	// this will let the -start runner know to detach and let us run in the background
-	// if we don't close stdout, Unix produces SIGPIPE when we next try to write to it
-	// unfortunately os.Stderr can't be closed because of a potential issue in go (see go "os" docs)
-	// but that's okay because we'll never use os.Stderr
 	if c.Background {
 		log.Printf("%v %v", "[X]", "Synced. Will run in background..")
-		log.ScreenOutput = nil
-		os.Stdout.Close()
+		background.Detach()
+	}
+
+	var watchdogC <-chan time.Time
+	if c.Watchdog != nil && c.WatchdogInterval > 0 {
+		ticker := time.NewTicker(c.WatchdogInterval)
+		defer ticker.Stop()
+		watchdogC = ticker.C
 	}
 
 	for {
-		log.Printf("%v %v", "[X]", "Synced. Watching for changes..")
+		if !c.isPaused() {
+			log.Printf("%v %v", "[X]", "Synced. Watching for changes..")
+		}
+		hooksC := c.hooksDue()
+
+	wait:
+		for {
+			select {
+			case <-hooksC:
+				hooksC = nil
+				if err := c.RunPostSyncHooks(); err != nil {
+					return true, err
+				}
+			case <-c.Watcher.C:
+				break wait
+			case <-c.syncC:
+				break wait
+			case <-watchdogC:
+				c.Watchdog()
+			case err := <-c.DoneC():
+				return true, err
+			case <-ctx.Done():
+				return true, nil
+			}
+		}
 
-		select {
-		case <-c.Watcher.C:
-			if err := c.Sync(); err != nil {
+		for c.isPaused() {
+			// Resume() will wake us with SyncNow()
+			select {
+			case <-c.syncC:
+			case <-watchdogC:
+				c.Watchdog()
+			case err := <-c.DoneC():
 				return true, err
+			case <-ctx.Done():
+				return true, nil
 			}
-		case err := <-c.DoneC():
+		}
+
+		if err := c.Sync(ctx); err != nil {
 			return true, err
 		}
 	}
+}
 
-	return true, fmt.Errorf("unexpected exit")
+// with nothing to watch, Run() returns after the first sync (see -once)
+func (c *Client) runsOnce() bool {
+	return c.Config.WatchLocal == "0" && c.Config.WatchRemote == "0"
 }
 
 func (c *Client) RunHello() error {
-	hello := &commands.Hello{c.Config}
+	hello := &commands.Hello{Config: c.Config, Token: c.Config.Token, Caps: commands.Caps}
 	err := c.SendCmd(hello)
 	if err != nil {
 		return err
@@ -110,37 +248,87 @@ func (c *Client) RunHello() error {
 
 	whatsup := cmd.(*commands.Whatsup)
 	c.remoteBasepath = whatsup.Basepath
+	c.remoteCaps = whatsup.Caps
+	if commands.HasCap(whatsup.Caps, commands.CapPing) {
+		c.StartHeartbeat(c.Config.Heartbeat)
+	}
+	c.ResumeTransfers = commands.HasCap(whatsup.Caps, commands.CapResume) && c.Config.PartialExpire > 0
+	if (c.Config.HookPostSyncRemote != "" || len(c.Config.OnChange) > 0) && !c.canRunRemoteHook() {
+		log.Warnln("The server is too old to run hook_post_sync_remote or on_change, upgrade it to use hooks")
+	}
 
-	if c.Config.Method == "directtls" {
-		log.Printf("Syncing: %v <-> %v:%v", c.GetBasepath(), c.Config.Host, c.remoteBasepath)
-	} else {
-		log.Printf("Syncing: %v <-> %v@%v:%v", c.GetBasepath(), c.Config.User, c.Config.Host, c.remoteBasepath)
+	arrow := "<->"
+	switch c.Config.Direction {
+	case "push":
+		arrow = "->"
+	case "pull":
+		arrow = "<-"
+	}
+	switch c.Config.Method {
+	case "directtls", "tcp":
+		log.Printf("Syncing: %v %v %v:%v", c.GetBasepath(), arrow, c.Config.Host, c.remoteBasepath)
+	case "unix", "exec":
+		log.Printf("Syncing: %v %v %v", c.GetBasepath(), arrow, c.remoteBasepath)
+	default:
+		log.Printf("Syncing: %v %v %v@%v:%v", c.GetBasepath(), arrow, c.Config.User, c.Config.Host, c.remoteBasepath)
 	}
 
 	return nil
 }
 
-func (c *Client) RunReqList() (filelist.FileList, error) {
+// also returns how long the server took to make the list, or 0 if it didn't say
+func (c *Client) RunReqList() (filelist.FileList, time.Duration, error) {
 	reqlist := &commands.ReqList{}
 	err := c.SendCmd(reqlist)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	cmd, _, err := c.WaitFor("RESLIST")
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	reply := cmd.(*commands.ResList)
-	return reply.FileList, nil
+	return reply.FileList, reply.ScanTime, nil
+}
+
+// asks the server which of these files it already has part of
+func (c *Client) RunReqPartial(items []*filelist.FileListItem) (map[string]*commands.Partial, error) {
+	partials := map[string]*commands.Partial{}
+
+	files := []commands.Partial{}
+	for _, file := range commands.MakePartials(items) {
+		if c.CanResume(file.Size) {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return partials, nil
+	}
+
+	err := c.SendCmd(&commands.ReqPartial{Files: files})
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, _, err := c.WaitFor("RESPARTIAL")
+	if err != nil {
+		return nil, err
+	}
+
+	reply := cmd.(*commands.ResPartial)
+	for i := range reply.Partials {
+		partials[reply.Partials[i].Path] = &reply.Partials[i]
+	}
+	return partials, nil
 }
 
 func (c *Client) handlePROGRESS(cmd commands.Command) {
 	progress := cmd.(*commands.Progress)
 
 	select {
-	case c.Progress <- progresswriter.Progress{progress.Percent, progress.Eta}:
+	case c.Progress <- progresswriter.Progress{Percent: progress.Percent, Eta: progress.Eta}:
 	default:
 	}
 }
@@ -0,0 +1,29 @@
+package client
+
+type EventType string
+
+const (
+	EventPush         EventType = "push"
+	EventPull         EventType = "pull"
+	EventDeleteLocal  EventType = "delete_local"
+	EventDeleteRemote EventType = "delete_remote"
+	EventConflict     EventType = "conflict"
+	EventSynced       EventType = "synced"
+	EventError        EventType = "error"
+	// a sync would have deleted more than max_delete files, so we paused instead
+	EventMaxDelete EventType = "max_delete"
+	// the session failed to connect several times in a row, and is still trying
+	EventReconnectFailing EventType = "reconnect_failing"
+)
+
+type Event struct {
+	Type EventType
+	Path string
+	Err  error
+}
+
+func (c *Client) emit(event Event) {
+	if c.OnEvent != nil {
+		c.OnEvent(event)
+	}
+}
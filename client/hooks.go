@@ -0,0 +1,115 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unisync/commands"
+	"unisync/filelist"
+	"unisync/hooks"
+	"unisync/log"
+)
+
+// changes waiting for hook_post_sync_local and hook_post_sync_remote
+// they run once things have been quiet for hook_debounce, so a burst of syncs
+// (a git checkout, a build) only runs them once
+// the session keeps them across reconnects, see Client.PendingHooks
+type PendingHooks struct {
+	local  map[string]struct{}
+	remote map[string]struct{}
+}
+
+func (c *Client) canRunRemoteHook() bool {
+	hasHooks := c.Config.HookPostSyncRemote != "" || len(c.Config.OnChange) > 0
+	return hasHooks && commands.HasCap(c.remoteCaps, commands.CapHooks)
+}
+
+// after each sync plan, remember what it changed for the post sync hooks
+// applied is what got done, see RunSyncPlan
+func (c *Client) queueHooks(applied *filelist.SyncPlan) {
+	add := func(paths *map[string]struct{}, items []*filelist.FileListItem) {
+		if len(items) == 0 {
+			return
+		}
+		if *paths == nil {
+			*paths = map[string]struct{}{}
+		}
+		for _, item := range items {
+			(*paths)[item.Path] = struct{}{}
+		}
+	}
+
+	if c.Config.HookPostSyncLocal != "" {
+		add(&c.PendingHooks.local, applied.LocalChanges())
+	}
+	if c.canRunRemoteHook() {
+		add(&c.PendingHooks.remote, applied.RemoteChanges())
+	}
+}
+
+// fires once the post sync hooks are due, or never if there are none
+func (c *Client) hooksDue() <-chan time.Time {
+	if len(c.PendingHooks.local) == 0 && len(c.PendingHooks.remote) == 0 {
+		return nil
+	}
+	return time.After(c.Config.HookDebounce)
+}
+
+func (c *Client) RunPostSyncHooks() error {
+	local, remote := c.PendingHooks.local, c.PendingHooks.remote
+	*c.PendingHooks = PendingHooks{}
+
+	if len(local) > 0 {
+		err := c.hookDone(hooks.Run("hook_post_sync_local", c.Config.HookPostSyncLocal, c.GetBasepath(), sortedPaths(local), nil))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(remote) > 0 {
+		err := c.SendCmd(&commands.ReqHook{Paths: sortedPaths(remote)})
+		if err != nil {
+			return err
+		}
+		cmd, _, err := c.WaitFor("RESHOOK")
+		if err != nil {
+			return err
+		}
+
+		if reply := cmd.(*commands.ResHook); reply.Err != "" {
+			return c.hookDone(fmt.Errorf("%v", reply.Err))
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) runPreSyncHook(syncplan *filelist.SyncPlan) error {
+	if c.Config.HookPreSync == "" {
+		return nil
+	}
+
+	paths := []string{}
+	for _, item := range syncplan.FilesChanged() {
+		paths = append(paths, item.Path)
+	}
+	return c.hookDone(hooks.Run("hook_pre_sync", c.Config.HookPreSync, c.GetBasepath(), paths, nil))
+}
+
+// a failed hook only stops the sync with hook_strict
+func (c *Client) hookDone(err error) error {
+	if err == nil || c.Config.HookStrict {
+		return err
+	}
+	log.Warnln(err)
+	return nil
+}
+
+func sortedPaths(paths map[string]struct{}) []string {
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
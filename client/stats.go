@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// what a sync did, or in Status.Totals, everything since we connected
+type SyncStats struct {
+	// syncs that completed
+	Syncs int `json:"syncs"`
+
+	Pushed        int   `json:"pushed"`
+	PushedBytes   int64 `json:"pushed_bytes"`
+	Pulled        int   `json:"pulled"`
+	PulledBytes   int64 `json:"pulled_bytes"`
+	DeletedLocal  int   `json:"deleted_local"`
+	DeletedRemote int   `json:"deleted_remote"`
+	Mkdirs        int   `json:"mkdirs"`
+	Symlinks      int   `json:"symlinks"`
+	Chmods        int   `json:"chmods"`
+
+	Duration time.Duration `json:"duration"`
+
+	// how long filelist.Make took on each side, for the last sync
+	// RemoteScan is 0 with older servers
+	LocalScan  time.Duration `json:"local_scan"`
+	RemoteScan time.Duration `json:"remote_scan"`
+}
+
+// adds up everything, except the scan times, which are replaced
+func (s *SyncStats) Add(other SyncStats) {
+	s.Syncs += other.Syncs
+	s.Pushed += other.Pushed
+	s.PushedBytes += other.PushedBytes
+	s.Pulled += other.Pulled
+	s.PulledBytes += other.PulledBytes
+	s.DeletedLocal += other.DeletedLocal
+	s.DeletedRemote += other.DeletedRemote
+	s.Mkdirs += other.Mkdirs
+	s.Symlinks += other.Symlinks
+	s.Chmods += other.Chmods
+	s.Duration += other.Duration
+	if other.LocalScan > 0 || other.RemoteScan > 0 {
+		s.LocalScan = other.LocalScan
+		s.RemoteScan = other.RemoteScan
+	}
+}
+
+// true if the sync did anything at all
+func (s SyncStats) Changed() bool {
+	return s.Pushed+s.Pulled+s.DeletedLocal+s.DeletedRemote+s.Mkdirs+s.Symlinks+s.Chmods > 0
+}
+
+// Throughput is in bytes per second, over the whole duration of the syncs
+func (s SyncStats) Throughput() int64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return int64(float64(s.PushedBytes+s.PulledBytes) / s.Duration.Seconds())
+}
+
+// a one line summary, like "2 pushed (1.5 MB), 1 deleted remotely in 1.2s (1.3 MB/s), scanned in 3ms local, 5ms remote"
+func (s SyncStats) String() string {
+	parts := []string{}
+	add := func(count int, format string, args ...interface{}) {
+		if count > 0 {
+			parts = append(parts, fmt.Sprintf(format, append([]interface{}{count}, args...)...))
+		}
+	}
+	add(s.Pushed, "%v pushed (%v)", FormatBytes(s.PushedBytes))
+	add(s.Pulled, "%v pulled (%v)", FormatBytes(s.PulledBytes))
+	add(s.DeletedLocal, "%v deleted locally")
+	add(s.DeletedRemote, "%v deleted remotely")
+	add(s.Mkdirs, "%v mkdir")
+	add(s.Symlinks, "%v symlink")
+	add(s.Chmods, "%v chmod")
+	if len(parts) == 0 {
+		parts = append(parts, "nothing changed")
+	}
+
+	str := strings.Join(parts, ", ") + " in " + roundDuration(s.Duration).String()
+	if s.PushedBytes+s.PulledBytes > 0 {
+		str += fmt.Sprintf(" (%v/s)", FormatBytes(s.Throughput()))
+	}
+
+	if s.LocalScan > 0 {
+		str += ", scanned in " + roundDuration(s.LocalScan).String() + " local"
+		if s.RemoteScan > 0 {
+			str += ", " + roundDuration(s.RemoteScan).String() + " remote"
+		}
+	}
+
+	return str
+}
+
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%v B", n)
+	}
+
+	value := float64(n)
+	for _, suffix := range []string{"KB", "MB", "GB", "TB"} {
+		value /= unit
+		if value < unit || suffix == "TB" {
+			return fmt.Sprintf("%.1f %v", value, suffix)
+		}
+	}
+	return "" // not reached
+}
+
+// keeps 3 significant digits or so, 1.234567s isn't easier to read than 1.23s
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d > time.Minute:
+		return d.Round(time.Second)
+	case d > time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
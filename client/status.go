@@ -0,0 +1,106 @@
+package client
+
+import (
+	"time"
+	"unisync/log"
+	"unisync/progressbar"
+)
+
+type Transfer struct {
+	Path string `json:"path"`
+	// "->" for push, "<-" for pull
+	Direction string `json:"direction"`
+	Percent   int    `json:"percent"`
+	Eta       int    `json:"eta"`
+}
+
+type Status struct {
+	Syncing  bool      `json:"syncing"`
+	Paused   bool      `json:"paused"`
+	LastSync time.Time `json:"last_sync"`
+	Queued   int       `json:"queued"`
+	Transfer *Transfer `json:"transfer,omitempty"`
+	// round trip time to the server, 0 if unknown
+	Latency time.Duration `json:"latency"`
+	// everything synced since we connected
+	Totals SyncStats `json:"totals"`
+}
+
+func (c *Client) Status() Status {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	status := c.status
+	status.Queued = c.Watcher.Pending()
+	status.Latency = c.Latency()
+	if status.Transfer != nil {
+		transfer := *status.Transfer
+		status.Transfer = &transfer
+	}
+	return status
+}
+
+func (c *Client) updateStatus(fn func(*Status)) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	fn(&c.status)
+}
+
+// tracks the progress of a file transfer for Status(), and draws the progress bar if we can
+func (c *Client) startTransfer(path, direction string) func() {
+	c.watchdog()
+	c.updateStatus(func(s *Status) {
+		s.Transfer = &Transfer{Path: path, Direction: direction}
+	})
+
+	drawBar := log.ScreenOutput != nil && log.ScreenLevel <= log.Notice && log.ScreenFormat != log.FormatJSON && progressbar.CanUse()
+	done := make(chan struct{})
+	stop := func() {
+		done <- struct{}{}
+		<-done
+		c.updateStatus(func(s *Status) {
+			s.Transfer = nil
+		})
+	}
+
+	go func() {
+		for {
+			select {
+			case progress := <-c.Progress:
+				c.watchdog()
+				c.updateStatus(func(s *Status) {
+					s.Transfer.Percent = progress.Percent
+					s.Transfer.Eta = progress.Eta
+				})
+				if drawBar {
+					progressbar.Draw(progress.Percent, progress.Eta)
+				}
+			case <-done:
+				if drawBar {
+					progressbar.Reset()
+				}
+				close(done)
+				return
+			}
+		}
+	}()
+
+	return stop
+}
+
+// calls c.Watchdog, but not more than once a second, since progress updates come in fast
+func (c *Client) watchdog() {
+	if c.Watchdog == nil {
+		return
+	}
+
+	c.statusLock.Lock()
+	if time.Since(c.lastWatchdog) < time.Second {
+		c.statusLock.Unlock()
+		return
+	}
+	c.lastWatchdog = time.Now()
+	c.statusLock.Unlock()
+
+	c.Watchdog()
+}
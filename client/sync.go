@@ -1,29 +1,104 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 	"unisync/commands"
 	"unisync/filelist"
 	"unisync/log"
-	"unisync/progressbar"
+	"unisync/metrics"
 )
 
-func (c *Client) Sync() error {
+// if ctx is cancelled, Sync stops early but returns no error
+// the cache then gets what was synced before that, see saveSynced
+func (c *Client) Sync(ctx context.Context) error {
+	c.updateStatus(func(s *Status) { s.Syncing = true })
+	defer c.updateStatus(func(s *Status) { s.Syncing = false })
+
 	c.Watcher.Ready()
 	log.Printf("%v %v", "<->", "Comparing..")
 
+	c.stats = SyncStats{}
+	start := time.Now()
+	sent, received := c.BytesSent(), c.BytesReceived()
+	measure := func() {
+		c.stats.Duration = time.Since(start)
+		c.stats.PushedBytes = c.BytesSent() - sent
+		c.stats.PulledBytes = c.BytesReceived() - received
+	}
+	// even if we fail halfway, whatever got transferred counts
+	defer func() {
+		measure()
+		c.updateStatus(func(s *Status) { s.Totals.Add(c.stats) })
+	}()
+
+	// a conflict that's only reported, not synced (see SyncPlan.Conflicts), is in every try
+	reported := map[string]bool{}
+	reportConflicts := func(syncplan *filelist.SyncPlan) {
+		for _, file := range syncplan.Conflicts {
+			if !reported[file.Path] {
+				reported[file.Path] = true
+				log.Action("<->", "CONFLICT", file.Path)
+				c.emit(Event{Type: EventConflict, Path: file.Path})
+			}
+		}
+	}
+
+	preHookDone := false
 	for tries := 1; tries < 3; tries++ {
-		syncplan, localList, err := c.MakeSyncPlan()
+		if ctx.Err() != nil {
+			if tries > 1 {
+				return c.saveSynced()
+			}
+			return nil
+		}
+
+		syncplan, localList, remoteList, err := c.MakeSyncPlan()
 		if err != nil {
 			return err
 		}
 
 		if syncplan.IsSynced() {
-			return c.SaveCache(localList)
+			reportConflicts(syncplan)
+			cacheList := localList
+			if c.Config.Direction != "both" {
+				// what we didn't sync still has to look changed next time
+				cacheList = filelist.SyncedList(localList, remoteList, c.cache)
+			}
+			err = c.SaveCache(cacheList)
+			if err == nil {
+				c.stats.Syncs = 1
+				metrics.Syncs.Inc()
+				metrics.LastSync.SetToCurrentTime()
+				metrics.Files.Set(float64(len(localList)))
+				metrics.ScanDuration.Set(c.stats.LocalScan.Seconds())
+				if c.stats.Changed() {
+					measure()
+					log.With(log.Fields{Direction: "<->", Action: "SYNCED", Size: c.stats.PushedBytes + c.stats.PulledBytes}).Printf("%v %v", "<->", c.stats)
+				}
+				c.updateStatus(func(s *Status) { s.LastSync = time.Now() })
+				c.emit(Event{Type: EventSynced})
+			}
+			return err
+		}
+
+		if !c.checkMaxDelete(syncplan) {
+			return nil
 		}
 
-		err = c.RunSyncPlan(syncplan)
+		if !preHookDone {
+			preHookDone = true
+			if err := c.runPreSyncHook(syncplan); err != nil {
+				return err
+			}
+		}
+
+		reportConflicts(syncplan)
+		applied := filelist.NewSyncPlan()
+		err = c.RunSyncPlan(ctx, syncplan, applied)
+		c.queueHooks(applied)
 		if err != nil {
 			return err
 		}
@@ -32,16 +107,73 @@ func (c *Client) Sync() error {
 	return fmt.Errorf("Unable to sync after several tries!")
 }
 
-func (c *Client) MakeSyncPlan() (*filelist.SyncPlan, filelist.FileList, error) {
-	remoteList, err := c.RunReqList()
+// after a sync plan was cut short, caches the files that now match on both sides,
+// and keeps the old cache for the rest so the next sync still sees them as changed
+func (c *Client) saveSynced() error {
+	remoteList, _, err := c.RunReqList()
+	if err != nil {
+		return err
+	}
+	localList, err := filelist.Make(c.GetBasepath(), c.Config.Ignore, c.Config.Symlinks)
+	if err != nil {
+		return err
+	}
+	cacheList, err := c.Cache()
+	if err != nil {
+		return err
+	}
+
+	return c.SaveCache(filelist.SyncedList(localList, remoteList, cacheList))
+}
+
+// returns false, and pauses, if syncplan deletes more than max_delete files on either side
+// a protection against an emptied or unmounted folder taking everything on the other side with it
+func (c *Client) checkMaxDelete(syncplan *filelist.SyncPlan) bool {
+	count := len(syncplan.LocalDel)
+	if len(syncplan.RemoteDel) > count {
+		count = len(syncplan.RemoteDel)
+	}
+	if c.Config.MaxDelete == 0 || count <= c.Config.MaxDelete {
+		return true
+	}
+
+	c.statusLock.Lock()
+	approved := c.deletesApproved
+	c.deletesApproved = false
+	if !approved {
+		c.status.Paused = true
+		c.pausedForDeletes = true
+	}
+	c.statusLock.Unlock()
+
+	if approved {
+		log.Printf("Deleting %v files, as approved", count)
+		return true
+	}
+
+	next := "-resume"
+	if c.runsOnce() {
+		next = "raise max_delete"
+	}
+	err := fmt.Errorf("refusing to delete %v files (max_delete is %v), check and then %v to go ahead", count, c.Config.MaxDelete, next)
+	log.With(log.Fields{Action: "MAX_DELETE", Err: err}).Warnf("%v %v", "[X]", err)
+	c.emit(Event{Type: EventMaxDelete, Err: err})
+	return false
+}
+
+func (c *Client) MakeSyncPlan() (*filelist.SyncPlan, filelist.FileList, filelist.FileList, error) {
+	remoteList, scanTime, err := c.RunReqList()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	c.stats.RemoteScan = scanTime
 
+	start := time.Now()
 	localList, err := filelist.Make(c.GetBasepath(), c.Config.Ignore, c.Config.Symlinks)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	c.stats.LocalScan = time.Since(start)
 
 	// if one side or the other is empty, don't use the cache
 	// we'll assume that we want the empty side repopulated, and never want the full side emptied
@@ -51,18 +183,21 @@ func (c *Client) MakeSyncPlan() (*filelist.SyncPlan, filelist.FileList, error) {
 
 	cacheList, err := c.Cache()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	b := filelist.NewSyncPlanBuilder(c.Config.Prefer, c.Config.ChmodMask, c.Config.ChmodDirMask)
+	b.SetDirection(c.Config.Direction)
 	syncplan := b.BuildSyncPlan(localList, remoteList, cacheList)
-	return syncplan, localList, nil
+	return syncplan, localList, remoteList, nil
 }
 
-func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
+// each item that gets done is added to applied, so if this stops halfway,
+// applied is what it did get to
+func (c *Client) RunSyncPlan(ctx context.Context, syncplan *filelist.SyncPlan, applied *filelist.SyncPlan) error {
 	var err error
 	for _, file := range syncplan.LocalDel {
-		log.Printf("%v %v %v", "<-", "DEL", file.Path)
+		log.Action("<-", "DEL", file.Path)
 
 		// os.Remove() is not good enough because there could be a folder with ignored files in it
 		// those files won't get removed before we try to remove the folder itself
@@ -70,10 +205,13 @@ func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
 		if err != nil {
 			return err
 		}
+		c.stats.DeletedLocal++
+		applied.DelLocal(file)
+		c.emit(Event{Type: EventDeleteLocal, Path: file.Path})
 	}
 
 	for _, file := range syncplan.RemoteDel {
-		log.Printf("%v %v %v", "->", "DEL", file.Path)
+		log.Action("->", "DEL", file.Path)
 	}
 	if len(syncplan.RemoteDel) > 0 {
 		del := commands.MakeDel(syncplan.RemoteDel)
@@ -85,18 +223,26 @@ func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
 		if err != nil {
 			return err
 		}
+
+		c.stats.DeletedRemote += len(syncplan.RemoteDel)
+		for _, file := range syncplan.RemoteDel {
+			applied.DelRemote(file)
+			c.emit(Event{Type: EventDeleteRemote, Path: file.Path})
+		}
 	}
 
 	for _, file := range syncplan.LocalMkdir {
-		log.Printf("%v %v %v", "<-", "MKDIR", file.Path)
+		log.Action("<-", "MKDIR", file.Path)
 		err = c.Mkdir(file.Path, file.Mode)
 		if err != nil {
 			return err
 		}
+		c.stats.Mkdirs++
+		applied.Pull(file)
 	}
 
 	for _, file := range syncplan.RemoteMkdir {
-		log.Printf("%v %v %v", "->", "MKDIR", file.Path)
+		log.Action("->", "MKDIR", file.Path)
 	}
 	if len(syncplan.RemoteMkdir) > 0 {
 		mkdir := commands.MakeMkdir(syncplan.RemoteMkdir)
@@ -108,18 +254,24 @@ func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
 		if err != nil {
 			return err
 		}
+		c.stats.Mkdirs += len(syncplan.RemoteMkdir)
+		for _, file := range syncplan.RemoteMkdir {
+			applied.Push(file)
+		}
 	}
 
 	for _, file := range syncplan.LocalMklink {
-		log.Printf("%v %v %v", "<-", "SYMLINK", file.Path)
+		log.Action("<-", "SYMLINK", file.Path)
 		err = c.Symlink(file.Symlink, file.Path)
 		if err != nil {
 			return err
 		}
+		c.stats.Symlinks++
+		applied.Pull(file)
 	}
 
 	for _, file := range syncplan.RemoteMklink {
-		log.Printf("%v %v %v", "->", "SYMLINK", file.Path)
+		log.Action("->", "SYMLINK", file.Path)
 	}
 	if len(syncplan.RemoteMklink) > 0 {
 		symlink := commands.MakeSymlink(syncplan.RemoteMklink)
@@ -131,18 +283,24 @@ func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
 		if err != nil {
 			return err
 		}
+		c.stats.Symlinks += len(syncplan.RemoteMklink)
+		for _, file := range syncplan.RemoteMklink {
+			applied.Push(file)
+		}
 	}
 
 	for _, file := range syncplan.LocalChmod {
-		log.Printf("%v %v %v %v", "<-", "CHMOD", file.Path, file.Mode)
+		log.Action("<-", "CHMOD", file.Path, file.Mode)
 		err = c.Chmod(file.Path, file.Mode)
 		if err != nil {
 			return err
 		}
+		c.stats.Chmods++
+		applied.ChmodLocal(file)
 	}
 
 	for _, file := range syncplan.RemoteChmod {
-		log.Printf("%v %v %v %v", "->", "CHMOD", file.Path, file.Mode)
+		log.Action("->", "CHMOD", file.Path, file.Mode)
 	}
 	if len(syncplan.RemoteChmod) > 0 {
 		chmod := commands.MakeChmod(syncplan.RemoteChmod)
@@ -154,25 +312,43 @@ func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
 		if err != nil {
 			return err
 		}
+		c.stats.Chmods += len(syncplan.RemoteChmod)
+		for _, file := range syncplan.RemoteChmod {
+			applied.ChmodRemote(file)
+		}
+	}
+
+	partials, err := c.RunReqPartial(syncplan.PushFile)
+	if err != nil {
+		return err
 	}
 
 	for _, file := range syncplan.PushFile {
-		log.Printf("%v %v", "->", file.Path)
-		stop := c.startProgressBar()
-		err = c.SendFile(file.Path)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		log.Transfer("->", file.Path, file.Size)
+		stop := c.startTransfer(file.Path, "->")
+		err = c.SendFile(file.Path, partials[file.Path])
 		stop()
 		if err != nil {
 			return err
 		}
+		c.stats.Pushed++
+		applied.Push(file)
+		c.emit(Event{Type: EventPush, Path: file.Path})
 	}
 
-	if len(syncplan.PullFile) > 0 {
-		paths := map[string]bool{}
+	// once the server starts sending, we have to receive everything we asked for
+	if len(syncplan.PullFile) > 0 && ctx.Err() == nil {
+		paths := map[string]*filelist.FileListItem{}
 		for _, file := range syncplan.PullFile {
-			paths[file.Path] = true
+			paths[file.Path] = file
 		}
 
 		pull := commands.MakePull(syncplan.PullFile)
+		pull.Partials = c.FindPartials(commands.MakePartials(syncplan.PullFile))
 		err = c.SendCmd(pull)
 		if err != nil {
 			return err
@@ -185,13 +361,18 @@ func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
 			}
 
 			push := cmd.(*commands.Push)
-			log.Printf("%v %v", "<-", push.Path)
-			stop := c.startProgressBar()
+			log.Transfer("<-", push.Path, push.Size)
+			stop := c.startTransfer(push.Path, "<-")
 			err = c.ReceiveFile(push, waiter)
 			stop()
 			if err != nil {
 				return err
 			}
+			c.stats.Pulled++
+			if file, ok := paths[push.Path]; ok {
+				applied.Pull(file)
+			}
+			c.emit(Event{Type: EventPull, Path: push.Path})
 
 			delete(paths, push.Path)
 		}
@@ -200,30 +381,3 @@ func (c *Client) RunSyncPlan(syncplan *filelist.SyncPlan) error {
 
 	return nil
 }
-
-func (c *Client) startProgressBar() func() {
-	if log.ScreenOutput == nil || log.ScreenLevel > log.Notice || !progressbar.CanUse() {
-		return func() {}
-	}
-
-	done := make(chan struct{})
-	stop := func() {
-		done <- struct{}{}
-		<-done
-	}
-
-	go func() {
-		for {
-			select {
-			case progress := <-c.Progress:
-				progressbar.Draw(progress.Percent, progress.Eta)
-			case <-done:
-				progressbar.Reset()
-				close(done)
-				return
-			}
-		}
-	}()
-
-	return stop
-}
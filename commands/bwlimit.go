@@ -0,0 +1,17 @@
+package commands
+
+// changes bwlimit_up and bwlimit_down on the server while connected
+// only sent if the server has CapBwlimit
+type Bwlimit struct {
+	// in KB/s, 0 for no limit
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+func (c *Bwlimit) CmdType() string {
+	return "BWLIMIT"
+}
+
+func (c *Bwlimit) BodyLen() int {
+	return 0
+}
@@ -0,0 +1,23 @@
+package commands
+
+// capabilities are sent with HELLO and WHATSUP, so that neither side sends
+// a command that an older version on the other side wouldn't understand
+const (
+	CapPing    = "ping"
+	CapResume  = "resume"
+	CapBwlimit = "bwlimit"
+	CapHooks   = "hooks"
+	CapOutput  = "output"
+)
+
+// what this version supports
+var Caps = []string{CapPing, CapResume, CapBwlimit, CapHooks, CapOutput}
+
+func HasCap(caps []string, cap string) bool {
+	for _, c := range caps {
+		if c == cap {
+			return true
+		}
+	}
+	return false
+}
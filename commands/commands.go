@@ -43,6 +43,8 @@ func Parse(str string) (cmd Command, err error) {
 	jsonString = strings.TrimSpace(jsonString)
 
 	switch word {
+	case "BWLIMIT":
+		cmd = &Bwlimit{}
 	case "CHMOD":
 		cmd = &Chmod{}
 	case "DEL":
@@ -57,6 +59,12 @@ func Parse(str string) (cmd Command, err error) {
 		cmd = &Mkdir{}
 	case "OK":
 		cmd = &Ok{}
+	case "OUTPUT":
+		cmd = &Output{}
+	case "PING":
+		cmd = &Ping{}
+	case "PONG":
+		cmd = &Pong{}
 	case "PROGRESS":
 		cmd = &Progress{}
 	case "PULL":
@@ -65,8 +73,16 @@ func Parse(str string) (cmd Command, err error) {
 		cmd = &Push{}
 	case "REQLIST":
 		cmd = &ReqList{}
+	case "REQHOOK":
+		cmd = &ReqHook{}
+	case "REQPARTIAL":
+		cmd = &ReqPartial{}
 	case "RESLIST":
 		cmd = &ResList{}
+	case "RESHOOK":
+		cmd = &ResHook{}
+	case "RESPARTIAL":
+		cmd = &ResPartial{}
 	case "SYMLINK":
 		cmd = &Symlink{}
 	case "WHATSUP":
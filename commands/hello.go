@@ -4,6 +4,11 @@ import "unisync/config"
 
 type Hello struct {
 	Config *config.Config `json:"config"`
+
+	// only used with directtls, when the client has no certificate
+	Token string `json:"token,omitempty"`
+
+	Caps []string `json:"caps,omitempty"`
 }
 
 func (c *Hello) CmdType() string {
@@ -0,0 +1,29 @@
+package commands
+
+// once a sync has changed files on the server, and things have been quiet for
+// hook_debounce, the client asks it to run hook_post_sync_remote and on_change
+// only sent if the server has CapHooks
+type ReqHook struct {
+	Paths []string `json:"paths"`
+}
+
+func (c *ReqHook) CmdType() string {
+	return "REQHOOK"
+}
+
+func (c *ReqHook) BodyLen() int {
+	return 0
+}
+
+// a hook that fails isn't an ERROR, since it only drops the connection with hook_strict
+type ResHook struct {
+	Err string `json:"err,omitempty"`
+}
+
+func (c *ResHook) CmdType() string {
+	return "RESHOOK"
+}
+
+func (c *ResHook) BodyLen() int {
+	return 0
+}
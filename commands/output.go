@@ -0,0 +1,17 @@
+package commands
+
+// a line of output from a command the server runs for us, like on_change
+// only sent if the client has CapOutput
+type Output struct {
+	// what's running, like "on_change *.scss"
+	Name string `json:"name"`
+	Line string `json:"line"`
+}
+
+func (c *Output) CmdType() string {
+	return "OUTPUT"
+}
+
+func (c *Output) BodyLen() int {
+	return 0
+}
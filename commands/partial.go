@@ -0,0 +1,48 @@
+package commands
+
+import "unisync/filelist"
+
+// a file that was partly received before the connection dropped
+// the sender can resume from Offset, as long as its file still has the same
+// Size and ModifiedAt, and its first Offset bytes have the same sha256 as Sum
+type Partial struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	ModifiedAt int64  `json:"modified_at"`
+	Offset     int64  `json:"offset,omitempty"`
+	Sum        string `json:"sum,omitempty"`
+}
+
+func MakePartials(items []*filelist.FileListItem) []Partial {
+	partials := make([]Partial, len(items))
+	for i, item := range items {
+		partials[i] = Partial{Path: item.Path, Size: item.Size, ModifiedAt: item.ModifiedAt}
+	}
+	return partials
+}
+
+// before pushing, the client asks the server which files it already has part of
+// only sent if the server has CapResume
+type ReqPartial struct {
+	Files []Partial `json:"files"`
+}
+
+func (c *ReqPartial) CmdType() string {
+	return "REQPARTIAL"
+}
+
+func (c *ReqPartial) BodyLen() int {
+	return 0
+}
+
+type ResPartial struct {
+	Partials []Partial `json:"partials"`
+}
+
+func (c *ResPartial) CmdType() string {
+	return "RESPARTIAL"
+}
+
+func (c *ResPartial) BodyLen() int {
+	return 0
+}
@@ -0,0 +1,29 @@
+package commands
+
+// either side sends PING every so often when the other side has CapPing,
+// and answers a PING with a PONG, so a dead connection can be noticed
+type Ping struct {
+	// when the PING was sent, in unix nanoseconds by the sender's clock
+	// PONG sends it back, so the sender can work out the round trip time
+	Sent int64 `json:"sent"`
+}
+
+func (c *Ping) CmdType() string {
+	return "PING"
+}
+
+func (c *Ping) BodyLen() int {
+	return 0
+}
+
+type Pong struct {
+	Sent int64 `json:"sent"`
+}
+
+func (c *Pong) CmdType() string {
+	return "PONG"
+}
+
+func (c *Pong) BodyLen() int {
+	return 0
+}
@@ -4,6 +4,9 @@ import "unisync/filelist"
 
 type Pull struct {
 	Paths []string `json:"paths"`
+
+	// files we already have part of, only sent if the server has CapResume
+	Partials []Partial `json:"partials,omitempty"`
 }
 
 func (c *Pull) CmdType() string {
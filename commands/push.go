@@ -9,6 +9,10 @@ type Push struct {
 	Mode       fs.FileMode `json:"mode"`
 	Length     int         `json:"length"`
 	More       bool        `json:"more"`
+
+	// where this chunk goes in the file, more than 0 on the first chunk
+	// if the transfer was resumed (see Partial)
+	Offset int64 `json:"offset,omitempty"`
 }
 
 func (c *Push) CmdType() string {
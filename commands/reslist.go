@@ -1,9 +1,15 @@
 package commands
 
-import "unisync/filelist"
+import (
+	"time"
+	"unisync/filelist"
+)
 
 type ResList struct {
 	FileList filelist.FileList `json:"filelist"`
+
+	// how long filelist.Make took on the server, older servers don't send it
+	ScanTime time.Duration `json:"scan_time,omitempty"`
 }
 
 func (c *ResList) CmdType() string {
@@ -2,7 +2,8 @@ package commands
 
 // when a client sends HELLO, server responds with WHATSUP
 type Whatsup struct {
-	Basepath string `json:"basepath"`
+	Basepath string   `json:"basepath"`
+	Caps     []string `json:"caps,omitempty"`
 }
 
 func (c *Whatsup) CmdType() string {
@@ -1,12 +1,14 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,6 +20,18 @@ import (
 var once sync.Once
 var configDir string
 
+// in ConfigDir, applied to every config before its own settings
+var DefaultsFile = "defaults.conf"
+
+// each transport registers its method name here, along with
+// a function that validates the settings it uses
+var methodsLock sync.Mutex
+var methods = map[string]func(*Config) error{}
+
+// these are always valid, even when the binary doesn't link their transports,
+// anything else has to be registered with RegisterMethod
+var builtinMethods = []string{"ssh", "internalssh", "directtls", "tcp", "unix", "exec"}
+
 // json is only used to transmit the needed parts of config to server
 // ini is used to parse the conf file on the client
 type Config struct {
@@ -27,16 +41,38 @@ type Config struct {
 	User           string        `json:"-" ini:"user"`
 	Host           string        `json:"-" ini:"host"`
 	Port           int           `json:"-" ini:"port"`
+	Socket         string        `json:"-" ini:"socket"`
+	Command        string        `json:"-" ini:"command"`
 	Method         string        `json:"-" ini:"method"`
-	Prefer         string        `json:"-"' ini:"prefer"`
+	Prefer         string        `json:"-" ini:"prefer"`
+	Direction      string        `json:"-" ini:"direction"`
 	Ignore         []string      `json:"ignore" ini:"ignore"`
 	SshPath        string        `json:"-" ini:"ssh_path"`
 	SshOpts        string        `json:"-" ini:"ssh_opts"`
 	SshKeys        []string      `json:"-" ini:"ssh_key"`
 	TlsKey         string        `json:"-" ini:"tls_key"`
+	TlsFingerprint string        `json:"-" ini:"tls_fingerprint"`
+	Token          string        `json:"-" ini:"token"`
 	Timeout        time.Duration `json:"-" ini:"timeout"`
 	ConnectTimeout time.Duration `json:"-" ini:"connect_timeout"`
+	RetryMin       time.Duration `json:"-" ini:"retry_min"`
+	RetryMax       time.Duration `json:"-" ini:"retry_max"`
+	MaxRetries     int           `json:"-" ini:"max_retries"`
+	Heartbeat      time.Duration `json:"heartbeat" ini:"heartbeat"`
+	PartialExpire  time.Duration `json:"partial_expire" ini:"partial_expire"`
+	BwlimitUp      int           `json:"bwlimit_up" ini:"bwlimit_up"`
+	BwlimitDown    int           `json:"bwlimit_down" ini:"bwlimit_down"`
+	MetricsListen  string        `json:"-" ini:"metrics_listen"`
+	MaxDelete      int           `json:"-" ini:"max_delete"`
+	NotifyCmd      string        `json:"-" ini:"notify_cmd,noexpand"`
+	NotifyDesktop  bool          `json:"-" ini:"notify_desktop"`
 	Log            string        `json:"-" ini:"log"`
+	LogFormat      string        `json:"-" ini:"log_format"`
+	LogLevel       string        `json:"-" ini:"log_level"`
+	LogTrace       bool          `json:"-" ini:"log_trace"`
+	LogMaxSize     int           `json:"-" ini:"log_max_size"`
+	LogMaxFiles    int           `json:"-" ini:"log_max_files"`
+	LogCompress    bool          `json:"-" ini:"log_compress"`
 	Symlinks       bool          `json:"symlinks" ini:"symlinks"`
 	Debug          bool          `json:"-" ini:"debug"`
 
@@ -55,6 +91,13 @@ type Config struct {
 	ChmodRemoteDir fs.FileMode `json:"chmod_remote_dir" ini:"chmod_remote_dir"`
 	ChmodMask      fs.FileMode `json:"chmod_mask" ini:"chmod_mask"`
 	ChmodDirMask   fs.FileMode `json:"chmod_dir_mask" ini:"chmod_dir_mask"`
+
+	HookPreSync        string        `json:"-" ini:"hook_pre_sync,noexpand"`
+	HookPostSyncLocal  string        `json:"-" ini:"hook_post_sync_local,noexpand"`
+	HookPostSyncRemote string        `json:"hook_post_sync_remote,omitempty" ini:"hook_post_sync_remote,noexpand"`
+	HookDebounce       time.Duration `json:"-" ini:"hook_debounce"`
+	HookStrict         bool          `json:"-" ini:"hook_strict"`
+	OnChange           OnChangeRules `json:"on_change,omitempty" ini:"on_change,noexpand"`
 }
 
 func New(name string) *Config {
@@ -64,11 +107,20 @@ func New(name string) *Config {
 		SshOpts:        "-e none -o BatchMode=yes -o StrictHostKeyChecking=no",
 		TlsKey:         "secure.key",
 		Prefer:         "newest",
+		Direction:      "both",
+		LogFormat:      "text",
+		LogMaxSize:     10,
+		LogMaxFiles:    5,
 		WatchLocal:     "1",
 		WatchRemote:    "1",
 		PollFreq:       250 * time.Millisecond,
 		Timeout:        300 * time.Second,
 		ConnectTimeout: 30 * time.Second,
+		RetryMin:       2 * time.Second,
+		RetryMax:       120 * time.Second,
+		Heartbeat:      15 * time.Second,
+		PartialExpire:  24 * time.Hour,
+		HookDebounce:   2 * time.Second,
 		ChmodLocal:     0644,
 		ChmodRemote:    0644,
 		ChmodLocalDir:  0755,
@@ -118,93 +170,272 @@ func iniParser() *ini.Parser {
 	}
 
 	parser := ini.New()
+	parser.SetEnv(os.LookupEnv)
 	parser.AddTypeMap("fs.FileMode", parseFileMode)
 	parser.AddTypeMap("time.Duration", parseDuration)
 	parser.AddTypeMap("bool", parseIniBool)
 	return parser
 }
 
-func Parse(path string) (*Config, error) {
+// Find turns a config name like "myserver" into the full path of its file
+// the file might not exist
+func Find(path string) string {
 	if !filepath.IsAbs(path) {
 		path = filepath.Join(ConfigDir(), path)
 	}
 
-	if !IsFile(path) {
-		if !strings.HasSuffix(path, ".conf") {
-			path = path + ".conf"
-		}
+	if !IsFile(path) && !strings.HasSuffix(path, ".conf") {
+		path = path + ".conf"
+	}
+	return path
+}
 
-		if !IsFile(path) {
-			return nil, fmt.Errorf("ConfigFile %v does not exist", path)
-		}
+// the name that a config is known by, and that its pid, log and cache files are named after
+func NameOf(path string) string {
+	path = Find(path)
+	if filepath.Base(path) == ProjectFile {
+		return projectName(filepath.Dir(path))
 	}
+
 	_, name := filepath.Split(path)
+	return name
+}
 
-	bytes, err := os.ReadFile(path)
+// a config file's contents, and what to call it in errors
+type source struct {
+	name string
+	data []byte
+	// refuses some settings in this source, can be nil
+	filter func(key, value string) error
+}
+
+// Parse reads defaults.conf and a config file, then applies settings ("key=value", see Set) on top
+// with an empty path there's no file, and the settings must at least have local and remote
+// for a project's .unisync.conf, see FindProject
+func Parse(path string, settings ...string) (*Config, error) {
+	name := ""
+	where := "settings"
+	projectDir := ""
+	sources := []source{}
+
+	defaults, err := readIfExists(filepath.Join(ConfigDir(), DefaultsFile))
 	if err != nil {
-		return nil, fmt.Errorf("Unable to read ConfigFile %v: %v", name, err)
+		return nil, fmt.Errorf("Unable to read %v: %v", DefaultsFile, err)
+	}
+	sources = append(sources, source{DefaultsFile, defaults, nil})
+
+	if path != "" {
+		path = Find(path)
+		if !IsFile(path) {
+			return nil, fmt.Errorf("ConfigFile %v does not exist", path)
+		}
+		_, name = filepath.Split(path)
+		where = "ConfigFile " + name
+
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read ConfigFile %v: %v", name, err)
+		}
+
+		if name != ProjectFile {
+			sources = append(sources, source{"ConfigFile " + name, bytes, nil})
+		} else {
+			projectDir = filepath.Dir(path)
+			name = projectName(projectDir)
+			where = "ConfigFile " + path
+
+			overrides := OverridesPath(projectDir)
+			sources = append(sources, source{"ConfigFile " + path, bytes, projectFilter(overrides)})
+
+			bytes, err := readIfExists(overrides)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to read %v: %v", overrides, err)
+			}
+			sources = append(sources, source{overrides, bytes, nil})
+		}
 	}
 
+	// [host:name] sections need the host, which could be set anywhere, even after them
+	probe := New(name)
+	if err := probe.load(sources, settings, ""); err != nil {
+		return nil, err
+	}
 	config := New(name)
-	err = iniParser().Unmarshal(bytes, config)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to parse ConfigFile %v: %v", name, err)
+	if err := config.load(sources, settings, probe.Host); err != nil {
+		return nil, err
+	}
+
+	config.expandPaths()
+	if projectDir != "" {
+		config.Local = projectLocal(projectDir, config.Local)
 	}
 
 	err = config.Validate()
 	if err != nil {
-		return nil, fmt.Errorf("Problem in ConfigFile %v: %v", name, err)
+		return nil, fmt.Errorf("Problem in %v: %v", where, err)
 	}
 
 	return config, nil
 }
 
+// applies sources and then settings in that order,
+// so that ignore and the like add up while the last value wins for the rest
+// only the [host:name] sections for host apply
+func (c *Config) load(sources []source, settings []string, host string) error {
+	parser := iniParser()
+	parser.SetIncludeDir(ConfigDir(), ExpandHome)
+	parser.SetSections(func(section string) (bool, error) {
+		kind, value, _ := strings.Cut(section, ":")
+		if kind != "host" || value == "" {
+			return false, fmt.Errorf("unknown section, should be [host:name]")
+		}
+		return value == host, nil
+	})
+
+	for _, source := range sources {
+		parser.SetFilter(source.filter)
+		if err := parser.Unmarshal(source.data, c); err != nil {
+			return fmt.Errorf("Unable to parse %v: %v", source.name, err)
+		}
+	}
+
+	for _, setting := range settings {
+		if err := c.Set(setting); err != nil {
+			return fmt.Errorf("Unable to parse -set: %v", err)
+		}
+	}
+	return nil
+}
+
+// turns ~/ into $HOME in the paths used on this side
+// remote paths are left for the server, whose ~ might not be ours
+func (c *Config) expandPaths() {
+	c.Local = ExpandHome(c.Local)
+	c.Socket = ExpandHome(c.Socket)
+	c.TmpdirLocal = ExpandHome(c.TmpdirLocal)
+	c.TlsKey = ExpandHome(c.TlsKey)
+	c.Log = ExpandHome(c.Log)
+	for i := range c.SshKeys {
+		c.SshKeys[i] = ExpandHome(c.SshKeys[i])
+	}
+}
+
+// returns nothing if the file doesn't exist
+func readIfExists(path string) ([]byte, error) {
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return bytes, err
+}
+
+// Set takes a "key=value" setting, like a line of a config file
+// as in the file, settings like ignore get one more value each time
+func (c *Config) Set(setting string) error {
+	if !strings.Contains(setting, "=") {
+		return fmt.Errorf("%v <-- should be key=value", setting)
+	}
+	return iniParser().Unmarshal([]byte(setting), c)
+}
+
+// RemoteSettings turns [[user@]host:]path, like scp takes, into settings for Parse
+func RemoteSettings(remote string) []string {
+	host, path, found := strings.Cut(remote, ":")
+	// C:\some\path is a path on windows, not a host
+	if !found || len(host) <= 1 || strings.ContainsAny(host, "/\\") {
+		return []string{"remote=" + remote}
+	}
+
+	settings := []string{"remote=" + path}
+	if user, userHost, found := strings.Cut(host, "@"); found {
+		settings = append(settings, "user="+user)
+		host = userHost
+	}
+	return append(settings, "host="+host)
+}
+
+func RegisterMethod(name string, validate func(*Config) error) {
+	methodsLock.Lock()
+	defer methodsLock.Unlock()
+	methods[name] = validate
+}
+
+func methodValidator(name string) func(*Config) error {
+	methodsLock.Lock()
+	defer methodsLock.Unlock()
+	return methods[name]
+}
+
+func methodNames() []string {
+	methodsLock.Lock()
+	defer methodsLock.Unlock()
+
+	seen := map[string]bool{}
+	names := []string{}
+	for _, name := range builtinMethods {
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range methods {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (c *Config) Validate() error {
 	var err error
-	setting_missing_error := "setting %v is required (and missing)"
 
 	if c.Local == "" {
-		return fmt.Errorf(setting_missing_error, "local")
+		return SettingMissing("local")
 	}
 	if c.Remote == "" {
-		return fmt.Errorf(setting_missing_error, "remote")
+		return SettingMissing("remote")
 	}
 
 	if err := validateInArray("prefer", c.Prefer, []string{"newest", "oldest", "local", "remote"}); err != nil {
 		return err
 	}
-	if err := validateInArray("method", c.Method, []string{"ssh", "internalssh", "directtls"}); err != nil {
+	if err := validateInArray("method", c.Method, methodNames()); err != nil {
 		return err
 	}
-	if !strings.Contains(c.SshOpts, "-e none") {
-		return fmt.Errorf(`setting ssh_opts must contain "-e none"`)
-	}
-	if c.Method == "internalssh" || c.Method == "ssh" {
-		if c.Port == 0 {
-			c.Port = 22
-		}
-		if c.User == "" {
-			return fmt.Errorf(setting_missing_error, "user")
-		}
-		if c.Host == "" {
-			return fmt.Errorf(setting_missing_error, "host")
-		}
-		for _, sshkey := range c.SshKeys {
-			if !IsFile(sshkey) {
-				return fmt.Errorf("ssh_key=%v <-- file does not exist", sshkey)
-			}
+	if validate := methodValidator(c.Method); validate != nil {
+		if err := validate(c); err != nil {
+			return err
 		}
 	}
-	if c.Method == "directtls" && c.Port == 0 {
-		return fmt.Errorf(setting_missing_error, "port")
+	if c.RetryMin <= 0 {
+		return fmt.Errorf("setting retry_min must be more than 0")
 	}
-	if c.Method == "internalssh" && len(c.SshKeys) == 0 {
-		options := []string{"id_rsa", "id_ecdsa", "id_ed25519", "id_dsa", "identity"}
-		for _, option := range options {
-			option = filepath.Join(HomeDir(), ".ssh", option)
-			if IsFile(option) {
-				c.SshKeys = append(c.SshKeys, option)
-			}
+	if c.RetryMax < c.RetryMin {
+		return fmt.Errorf("setting retry_max must be at least retry_min")
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("setting max_retries can't be negative")
+	}
+	if c.HookDebounce < 0 {
+		return fmt.Errorf("setting hook_debounce can't be negative")
+	}
+	if c.MaxDelete < 0 {
+		return fmt.Errorf("setting max_delete can't be negative")
+	}
+	if c.BwlimitUp < 0 || c.BwlimitDown < 0 {
+		return fmt.Errorf("settings bwlimit_up and bwlimit_down can't be negative")
+	}
+	if err := validateInArray("direction", c.Direction, []string{"both", "push", "pull"}); err != nil {
+		return err
+	}
+	if err := validateInArray("log_format", c.LogFormat, []string{"text", "json"}); err != nil {
+		return err
+	}
+	if c.LogMaxSize < 0 || c.LogMaxFiles < 0 {
+		return fmt.Errorf("settings log_max_size and log_max_files can't be negative")
+	}
+	if c.LogLevel != "" {
+		if _, err := log.ParseLevel(c.LogLevel); err != nil {
+			return fmt.Errorf("setting log_level: %v", err)
 		}
 	}
 	if c.WatchLocal, err = validateExtendedBool(c.WatchLocal, "poll"); err != nil {
@@ -227,6 +458,10 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+func SettingMissing(name string) error {
+	return fmt.Errorf("setting %v is required (and missing)", name)
+}
+
 func validateInArray(name, value string, options []string) error {
 	for _, option := range options {
 		if value == option {
@@ -275,12 +510,16 @@ func HomeDir() string {
 	return home
 }
 
-func ResolvePath(oldpath string) (string, error) {
-	newpath := oldpath
-
-	if strings.HasPrefix(newpath, "~/") {
-		newpath = strings.Replace(newpath, "~", HomeDir(), 1)
+// ExpandHome turns ~/some/path into an absolute path in $HOME
+func ExpandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return filepath.Join(HomeDir(), path[1:])
 	}
+	return path
+}
+
+func ResolvePath(oldpath string) (string, error) {
+	newpath := ExpandHome(oldpath)
 
 	var err error
 	newpath, err = filepath.Abs(newpath)
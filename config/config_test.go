@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemoteSettings(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   []string
+	}{
+		{"/srv/app", []string{"remote=/srv/app"}},
+		{"srv/app", []string{"remote=srv/app"}},
+		{"host:/srv/app", []string{"remote=/srv/app", "host=host"}},
+		{"host:app", []string{"remote=app", "host=host"}},
+		{"user@host:/srv/app", []string{"remote=/srv/app", "user=user", "host=host"}},
+		{"user@host:~/app", []string{"remote=~/app", "user=user", "host=host"}},
+
+		// a drive letter isn't a host
+		{`C:\srv\app`, []string{`remote=C:\srv\app`}},
+		{"C:/srv/app", []string{"remote=C:/srv/app"}},
+		// neither is a path with a colon further in
+		{"./a:b", []string{"remote=./a:b"}},
+	}
+
+	for _, test := range tests {
+		got := RemoteSettings(test.remote)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.remote, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// on_change = *.scss -> npm run build:css
+// runs the command on the server once a sync changes a file there that matches the pattern
+// patterns work like in .gitignore
+type OnChange struct {
+	Pattern string `json:"pattern"`
+	Command string `json:"command"`
+}
+
+// each on_change line adds a rule
+type OnChangeRules []OnChange
+
+func (r *OnChangeRules) UnmarshalINI(data []byte) error {
+	pattern, command, found := strings.Cut(string(data), "->")
+	pattern = strings.TrimSpace(pattern)
+	command = strings.TrimSpace(command)
+	if !found || pattern == "" || command == "" {
+		return fmt.Errorf("should be: pattern -> command")
+	}
+
+	*r = append(*r, OnChange{Pattern: pattern, Command: command})
+	return nil
+}
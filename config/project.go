@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// a config committed at the root of a project, found by running unisync anywhere inside it
+var ProjectFile = ".unisync.conf"
+
+// FindProject looks for ProjectFile in dir and then in each of its parents
+// returns "" if there's none
+func FindProject(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if IsFile(path) {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// FindProjectHere is FindProject() from the current directory
+func FindProjectHere() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return FindProject(dir)
+}
+
+// OverridesPath is where someone can keep their own settings for a project, like user,
+// without changing the project's ProjectFile for everyone
+// it's named like the project's pid and log files, so projects in folders with the same name don't share it
+func OverridesPath(projectDir string) string {
+	return filepath.Join(ConfigDir(), "overrides", projectName(projectDir))
+}
+
+// settings that run commands, or read or write files outside the project, on this computer
+// anyone who can commit to a project can change its ProjectFile, so these can only go in OverridesPath
+var projectRestricted = map[string]bool{
+	"include":               true,
+	"name":                  true,
+	"socket":                true,
+	"command":               true,
+	"ssh_path":              true,
+	"ssh_opts":              true,
+	"ssh_key":               true,
+	"tls_key":               true,
+	"metrics_listen":        true,
+	"notify_cmd":            true,
+	"log":                   true,
+	"tmpdir_local":          true,
+	"remote_unisync_path":   true,
+	"hook_pre_sync":         true,
+	"hook_post_sync_local":  true,
+	"hook_post_sync_remote": true,
+	"on_change":             true,
+}
+
+// refuses projectRestricted settings, and a local that isn't inside the project
+func projectFilter(overrides string) func(key, value string) error {
+	return func(key, value string) error {
+		if projectRestricted[key] {
+			return fmt.Errorf("not allowed in %v, set it in %v instead", ProjectFile, overrides)
+		}
+		if key == "local" && !isInsideProject(value) {
+			return fmt.Errorf("must be a folder inside the project, set it in %v to sync somewhere else", overrides)
+		}
+		return nil
+	}
+}
+
+func isInsideProject(local string) bool {
+	local = filepath.Clean(local)
+	// \path is not absolute on windows, but it's not in the project either
+	if filepath.IsAbs(local) || filepath.VolumeName(local) != "" || os.IsPathSeparator(local[0]) || local[0] == '~' {
+		return false
+	}
+	return local != ".." && !strings.HasPrefix(local, ".."+string(filepath.Separator))
+}
+
+// pid, log and cache files go in ConfigDir like any other config's,
+// so the name has to tell apart projects in folders with the same name
+func projectName(projectDir string) string {
+	sum := md5.Sum([]byte(projectDir))
+	return fmt.Sprintf("%v-%x.conf", filepath.Base(projectDir), sum[:4])
+}
+
+// local is relative to the project, and is the project itself if it isn't set
+func projectLocal(projectDir, local string) string {
+	local = ExpandHome(local)
+	if filepath.IsAbs(local) {
+		return local
+	}
+	return filepath.Join(projectDir, local)
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "unisync-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("UNISYNC_DIR", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestProjectRestrictions(t *testing.T) {
+	write := func(path, data string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := "remote = /srv/app\nmethod = tcp\nhost = example.com\nport = 1234\n"
+
+	tests := []struct {
+		project   string
+		overrides string
+		wantErr   string
+	}{
+		{"", "", ""},
+		{"local = sub", "", ""},
+
+		// anyone who can commit to the project could run commands or write files with these
+		{"hook_pre_sync = touch /tmp/pwned", "", "not allowed"},
+		{"notify_cmd = touch /tmp/pwned", "", "not allowed"},
+		{"ssh_opts = -oProxyCommand=touch", "", "not allowed"},
+		{"log = /tmp/pwned.log", "", "not allowed"},
+		{"include = /etc/passwd", "", "not allowed"},
+		{"local = ../other", "", "must be a folder inside the project"},
+		{"local = /etc", "", "must be a folder inside the project"},
+		{"local = ~/.ssh", "", "must be a folder inside the project"},
+
+		// they're fine in the overrides file, which only the user can change
+		{"", "hook_pre_sync = make\nlocal = ..", ""},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, ProjectFile)
+		write(path, base+test.project)
+		if test.overrides != "" {
+			write(OverridesPath(dir), test.overrides)
+		}
+
+		_, err := Parse(path)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%q + overrides %q: %v", test.project, test.overrides, err)
+		} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%q: got error %v, want %q", test.project, err, test.wantErr)
+		}
+		os.Remove(OverridesPath(dir))
+	}
+}
+
+func TestOverridesPath(t *testing.T) {
+	a := OverridesPath(filepath.Join("one", "app"))
+	b := OverridesPath(filepath.Join("two", "app"))
+	if a == b {
+		t.Errorf("two projects named app share %v", a)
+	}
+}
@@ -0,0 +1,133 @@
+// Package control lets one unisync process talk to another one that's running
+// in the background, through a unix socket in the ConfigDir.
+// Each connection sends one Request and gets back one Response, as lines of json.
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+	"unisync/config"
+	"unisync/log"
+	"unisync/server"
+)
+
+type Request struct {
+	Cmd string `json:"cmd"`
+	Arg string `json:"arg,omitempty"`
+}
+
+type Response struct {
+	Err    string          `json:"err,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// the result is encoded as json and sent back to the caller
+type HandlerFn func(req *Request) (any, error)
+
+type Listener struct {
+	listener net.Listener
+	handler  HandlerFn
+}
+
+var timeout = 5 * time.Second
+
+func SocketPath(name string) string {
+	return filepath.Join(config.ConfigDir(), name+".sock")
+}
+
+func Listen(name string, handler HandlerFn) (*Listener, error) {
+	// fails if another copy of this config is running, replaces a socket left behind by one that crashed
+	listener, err := server.ListenUnix(SocketPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{listener: listener, handler: handler}
+	go l.acceptLoop()
+	return l, nil
+}
+
+func (l *Listener) Close() error {
+	return l.listener.Close()
+}
+
+// separate goroutine
+func (l *Listener) acceptLoop() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go l.serve(conn)
+	}
+}
+
+// separate goroutine
+func (l *Listener) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return
+	}
+
+	resp := &Response{}
+	req := &Request{}
+	if err := json.Unmarshal(line, req); err != nil {
+		resp.Err = fmt.Sprintf("invalid request: %v", err)
+	} else if result, err := l.handler(req); err != nil {
+		resp.Err = err.Error()
+	} else if result != nil {
+		resp.Result, err = json.Marshal(result)
+		if err != nil {
+			resp.Err = err.Error()
+		}
+	}
+
+	bytes, _ := json.Marshal(resp)
+	if _, err := conn.Write(append(bytes, '\n')); err != nil {
+		log.Debugln("control: unable to reply:", err)
+	}
+}
+
+// Send asks the instance running config name to do something
+// if result isn't nil, the reply is decoded into it
+func Send(name string, req *Request, result any) error {
+	conn, err := net.DialTimeout("unix", SocketPath(name), timeout)
+	if err != nil {
+		return fmt.Errorf("%v is not running (or is too old to be controlled)", name)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+
+	resp := &Response{}
+	if err := json.Unmarshal(line, resp); err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		return fmt.Errorf("%v", resp.Err)
+	}
+	if result != nil && resp.Result != nil {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
@@ -2,22 +2,31 @@ package filelist
 
 import (
 	"io/fs"
+	"sort"
 )
 
 type SyncPlanBuilder struct {
-	prefer   string
-	fileMask fs.FileMode
-	dirMask  fs.FileMode
+	prefer    string
+	direction string
+	fileMask  fs.FileMode
+	dirMask   fs.FileMode
 }
 
 func NewSyncPlanBuilder(prefer string, fileMask, dirMask fs.FileMode) *SyncPlanBuilder {
 	return &SyncPlanBuilder{
-		prefer:   prefer,
-		fileMask: fileMask,
-		dirMask:  dirMask,
+		prefer:    prefer,
+		direction: "both",
+		fileMask:  fileMask,
+		dirMask:   dirMask,
 	}
 }
 
+// SetDirection makes plans one way, for direction = push or pull (the default is both)
+// the side we sync from wins conflicts, and nothing changes on it (see SyncPlan.PushOnly)
+func (b *SyncPlanBuilder) SetDirection(direction string) {
+	b.direction = direction
+}
+
 func (b *SyncPlanBuilder) BuildSyncPlan(localList, remoteList, cacheList FileList) *SyncPlan {
 	plan := NewSyncPlan()
 	index := indexFileList(localList, remoteList, cacheList)
@@ -26,6 +35,13 @@ func (b *SyncPlanBuilder) BuildSyncPlan(localList, remoteList, cacheList FileLis
 		b.compare(plan, lists.local, lists.remote, lists.cache)
 	}
 
+	switch b.direction {
+	case "push":
+		plan.PushOnly()
+	case "pull":
+		plan.PullOnly()
+	}
+
 	plan.Clean()
 	return plan
 }
@@ -40,7 +56,8 @@ func (b *SyncPlanBuilder) compare(plan *SyncPlan, local, remote, cache *FileList
 
 	if local != nil && remote != nil && local.IsDir != remote.IsDir {
 		// if one side is a directory and the other side isn't, keep the directory
-		if local.IsDir {
+		// unless we only sync one way
+		if b.winsLocal(local.IsDir) {
 			plan.DelRemote(remote)
 		} else {
 			plan.DelLocal(local)
@@ -72,11 +89,27 @@ func (b *SyncPlanBuilder) compare(plan *SyncPlan, local, remote, cache *FileList
 		} else {
 			// if there is a cache, both sides might have been changed (or one could have been changed and the other deleted)
 			// if there is no cache, both sides exist and we need to pick a winner
-
-			if b.preferLocal(local, remote) {
-				plan.Push(local)
+			// that's only a conflict if there is a cache, without one it's just the first sync
+
+			if b.winsLocal(b.preferLocal(local, remote)) {
+				if local != nil {
+					plan.Push(local)
+					if cache != nil {
+						plan.Conflict(local)
+					}
+				} else {
+					// deleted here but changed there: only one way, we don't want to lose the change
+					plan.Conflict(remote)
+				}
 			} else {
-				plan.Pull(remote)
+				if remote != nil {
+					plan.Pull(remote)
+					if cache != nil {
+						plan.Conflict(remote)
+					}
+				} else {
+					plan.Conflict(local)
+				}
 			}
 		}
 	} else if !b.itemModesMatch(local, remote) {
@@ -92,7 +125,7 @@ func (b *SyncPlanBuilder) compare(plan *SyncPlan, local, remote, cache *FileList
 			plan.ChmodLocal(remote)
 
 		} else {
-			if b.preferLocal(local, remote) {
+			if b.winsLocal(b.preferLocal(local, remote)) {
 				plan.ChmodRemote(local)
 			} else {
 				plan.ChmodLocal(remote)
@@ -102,6 +135,34 @@ func (b *SyncPlanBuilder) compare(plan *SyncPlan, local, remote, cache *FileList
 
 }
 
+// SyncedList is what to cache after a one way sync (see SetDirection), or one that was cut short:
+// the files that now match on both sides, plus the old cache for the others,
+// so that a later two way sync still sees what was skipped as changed
+func SyncedList(localList, remoteList, cacheList FileList) FileList {
+	list := FileList{}
+	for _, lists := range indexFileList(localList, remoteList, cacheList) {
+		if lists.local != nil && lists.remote != nil && itemsMatch(lists.local, lists.remote) {
+			list = append(list, lists.local)
+		} else if lists.cache != nil {
+			list = append(list, lists.cache)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// when syncing one way, the side we sync from always wins
+func (b *SyncPlanBuilder) winsLocal(preferLocal bool) bool {
+	switch b.direction {
+	case "push":
+		return true
+	case "pull":
+		return false
+	}
+	return preferLocal
+}
+
 func (b *SyncPlanBuilder) preferLocal(local, remote *FileListItem) bool {
 	if local == nil {
 		return false
@@ -122,8 +183,6 @@ func (b *SyncPlanBuilder) preferLocal(local, remote *FileListItem) bool {
 	default:
 		panic("prefer must be one of: newest, oldest, local, remote")
 	}
-
-	return true
 }
 
 func (b *SyncPlanBuilder) itemModesMatch(local, remote *FileListItem) bool {
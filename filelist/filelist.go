@@ -20,6 +20,15 @@ type FileListItem struct {
 
 type FileList []*FileListItem
 
+// files being received are written to a temp file first, and renamed once complete
+// they should never be synced themselves
+var TmpPattern = ".tmp-unisync-*.tmp"
+
+func IsTmpFile(name string) bool {
+	match, _ := filepath.Match(TmpPattern, filepath.Base(name))
+	return match
+}
+
 func Make(basepath string, ignore []string, symlinks bool) (FileList, error) {
 	list := FileList{}
 	basepath = filepath.Clean(basepath)
@@ -46,6 +55,10 @@ func Make(basepath string, ignore []string, symlinks bool) (FileList, error) {
 			return nil
 		}
 
+		if !info.IsDir() && IsTmpFile(relpath) {
+			return nil
+		}
+
 		item := &FileListItem{Path: relpath}
 		if info.IsDir() {
 			item.IsDir = true
@@ -15,6 +15,11 @@ type SyncPlan struct {
 	RemoteChmod  []*FileListItem
 	LocalDel     []*FileListItem
 	RemoteDel    []*FileListItem
+
+	// files that changed on both sides, with the winning side's version
+	// they also appear in PushFile or PullFile, so they don't count toward IsSynced()
+	// except when syncing one way and the winning side deleted it, then they're only reported
+	Conflicts []*FileListItem
 }
 
 func NewSyncPlan() *SyncPlan {
@@ -27,6 +32,7 @@ func NewSyncPlan() *SyncPlan {
 		RemoteChmod: []*FileListItem{},
 		LocalDel:    []*FileListItem{},
 		RemoteDel:   []*FileListItem{},
+		Conflicts:   []*FileListItem{},
 	}
 
 	return plan
@@ -72,6 +78,10 @@ func (plan *SyncPlan) Pull(item *FileListItem) {
 	}
 }
 
+func (plan *SyncPlan) Conflict(item *FileListItem) {
+	plan.Conflicts = append(plan.Conflicts, item)
+}
+
 func (plan *SyncPlan) IsSynced() bool {
 	return len(plan.PullFile) == 0 &&
 		len(plan.PushFile) == 0 &&
@@ -85,6 +95,50 @@ func (plan *SyncPlan) IsSynced() bool {
 		len(plan.RemoteDel) == 0
 }
 
+// PushOnly drops everything the plan would change on the local side, for direction = push
+// see SyncPlanBuilder.SetDirection, which also has the local side win conflicts
+func (plan *SyncPlan) PushOnly() {
+	plan.PullFile = []*FileListItem{}
+	plan.LocalMkdir = []*FileListItem{}
+	plan.LocalMklink = []*FileListItem{}
+	plan.LocalChmod = []*FileListItem{}
+	plan.LocalDel = []*FileListItem{}
+}
+
+// PullOnly drops everything the plan would change on the remote side, for direction = pull
+// see SyncPlanBuilder.SetDirection, which also has the remote side win conflicts
+func (plan *SyncPlan) PullOnly() {
+	plan.PushFile = []*FileListItem{}
+	plan.RemoteMkdir = []*FileListItem{}
+	plan.RemoteMklink = []*FileListItem{}
+	plan.RemoteChmod = []*FileListItem{}
+	plan.RemoteDel = []*FileListItem{}
+}
+
+// what the plan changes on the local side
+func (plan *SyncPlan) LocalChanges() []*FileListItem {
+	changed := []*FileListItem{}
+	changed = append(changed, plan.PullFile...)
+	changed = append(changed, plan.LocalMkdir...)
+	changed = append(changed, plan.LocalMklink...)
+	changed = append(changed, plan.LocalChmod...)
+	changed = append(changed, plan.LocalDel...)
+
+	return changed
+}
+
+// what the plan changes on the remote side
+func (plan *SyncPlan) RemoteChanges() []*FileListItem {
+	changed := []*FileListItem{}
+	changed = append(changed, plan.PushFile...)
+	changed = append(changed, plan.RemoteMkdir...)
+	changed = append(changed, plan.RemoteMklink...)
+	changed = append(changed, plan.RemoteChmod...)
+	changed = append(changed, plan.RemoteDel...)
+
+	return changed
+}
+
 func (plan *SyncPlan) FilesChanged() []*FileListItem {
 	changed := []*FileListItem{}
 	changed = append(changed, plan.PullFile...)
@@ -0,0 +1,113 @@
+package filelist
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func file(path string, modifiedAt int64) *FileListItem {
+	return &FileListItem{Path: path, Size: 1, ModifiedAt: modifiedAt}
+}
+
+func dir(path string) *FileListItem {
+	return &FileListItem{Path: path, IsDir: true}
+}
+
+func paths(items []*FileListItem) []string {
+	list := []string{}
+	for _, item := range items {
+		list = append(list, item.Path)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestOneWaySyncPlan(t *testing.T) {
+	type want struct {
+		push, pull, delLocal, delRemote, conflicts []string
+	}
+	none := []string{}
+
+	tests := []struct {
+		name      string
+		direction string
+		local     FileList
+		remote    FileList
+		cache     FileList
+		want      want
+	}{
+		{"changed remotely", "both",
+			FileList{file("a", 1)}, FileList{file("a", 2)}, FileList{file("a", 1)},
+			want{none, []string{"a"}, none, none, none}},
+		{"changed remotely, push", "push",
+			FileList{file("a", 1)}, FileList{file("a", 2)}, FileList{file("a", 1)},
+			want{none, none, none, none, none}},
+		{"changed locally, push", "push",
+			FileList{file("a", 2)}, FileList{file("a", 1)}, FileList{file("a", 1)},
+			want{[]string{"a"}, none, none, none, none}},
+		{"changed locally, pull", "pull",
+			FileList{file("a", 2)}, FileList{file("a", 1)}, FileList{file("a", 1)},
+			want{none, none, none, none, none}},
+
+		// the side we sync from wins, even if prefer says otherwise
+		{"conflict, push", "push",
+			FileList{file("a", 2)}, FileList{file("a", 3)}, FileList{file("a", 1)},
+			want{[]string{"a"}, none, none, none, []string{"a"}}},
+		{"conflict, pull", "pull",
+			FileList{file("a", 3)}, FileList{file("a", 2)}, FileList{file("a", 1)},
+			want{none, []string{"a"}, none, none, []string{"a"}}},
+
+		// without a cache it's the first sync, so there's a winner but no conflict
+		{"no cache", "both",
+			FileList{file("a", 2)}, FileList{file("a", 3)}, FileList{},
+			want{none, []string{"a"}, none, none, none}},
+		{"no cache, push", "push",
+			FileList{file("a", 2)}, FileList{file("a", 3)}, FileList{},
+			want{[]string{"a"}, none, none, none, none}},
+
+		// deleting what the other side changed would lose the change, so it's only reported
+		{"deleted locally, changed remotely, push", "push",
+			FileList{}, FileList{file("a", 2), file("b", 1)}, FileList{file("a", 1), file("b", 1)},
+			want{none, none, none, []string{"b"}, []string{"a"}}},
+		{"deleted locally, push", "push",
+			FileList{}, FileList{file("a", 1), file("b", 1)}, FileList{file("a", 1), file("b", 1)},
+			want{none, none, none, []string{"a", "b"}, none}},
+		{"deleted remotely, pull", "pull",
+			FileList{file("a", 1)}, FileList{}, FileList{file("a", 1)},
+			want{none, none, []string{"a"}, none, none}},
+
+		// normally the directory wins, one way it's whatever the side we sync from has
+		{"file and dir", "both",
+			FileList{file("a", 1)}, FileList{dir("a")}, FileList{},
+			want{none, none, []string{"a"}, none, none}},
+		{"file and dir, push", "push",
+			FileList{file("a", 1)}, FileList{dir("a")}, FileList{},
+			want{none, none, none, []string{"a"}, none}},
+	}
+
+	for _, test := range tests {
+		b := NewSyncPlanBuilder("newest", 0777, 0777)
+		b.SetDirection(test.direction)
+		plan := b.BuildSyncPlan(test.local, test.remote, test.cache)
+
+		got := want{paths(plan.PushFile), paths(plan.PullFile), paths(plan.LocalDel), paths(plan.RemoteDel), paths(plan.Conflicts)}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSyncedList(t *testing.T) {
+	local := FileList{file("same", 2), file("pushed", 2), file("skipped", 2), file("new", 1)}
+	remote := FileList{file("same", 2), file("pushed", 2), file("skipped", 3), file("gone", 1)}
+	cache := FileList{file("same", 1), file("pushed", 1), file("skipped", 1), file("gone", 1)}
+
+	// what matches now is cached as it is, the rest keeps its old cache entry, or none
+	want := FileList{file("gone", 1), file("pushed", 2), file("same", 2), file("skipped", 1)}
+
+	got := SyncedList(local, remote, cache)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -14,11 +14,102 @@ see documentation at https://unisync.sh
 USAGE:
   unisync myserver
     reads config file from ~/.unisync/myserver.conf and syncs according to settings
+    ~/.unisync/defaults.conf applies to every config first, with [host:name] sections for one host only
+    include = common.conf reads the settings in ~/.unisync/common.conf, ignore and the like add up
+    values can use ${VAR} or ${VAR:-default} from the environment, and paths can start with ~/
+    ($${VAR} for a literal ${VAR}). hooks, on_change and notify_cmd are left as is, they run in a
+    shell that has the environment, with their UNISYNC_* variables and the remote's own $HOME
+    method = exec with command = docker exec -i box {remote_unisync} -stdserver syncs through any
+    command that starts unisync on the other side. {remote_unisync} is the first remote_unisync_path,
+    unlike ssh there's no shell there to try the others
+
+  unisync
+    inside a project, syncs according to the .unisync.conf found in the current folder or above it
+    local is relative to that folder (and is that folder if not set), and has to stay inside it
+    ~/.unisync/overrides/[folder name]-[hash].conf is read after it, for your own settings like user
+    anyone who can commit to the project can change .unisync.conf, so settings that run commands
+    or use files on this computer (hooks, on_change, notify_cmd, ssh_*, command, socket, log,
+    include, ...) are only allowed in the overrides file
+    the other commands below work the same way without a config name
+
+  unisync -local ./app -remote user@host:/srv/app
+    syncs without a config file, any other setting can be given with -set
+
+  unisync -set prefer=local -set ignore=*.log myserver
+    overrides a setting from the config file, or adds one more value for ignore, ssh_key, ...
+
+  unisync -once myserver
+    syncs once and exits, for scripts and git hooks. the exit code tells what happened:
+    0 nothing to do, 6 synced changes, 1 failed, 3 synced with conflicts, 4 stopped by max_delete,
+    5 interrupted (2 is a usage error)
+    watch_local = 0 and watch_remote = 0 in the config do the same
+
+  unisync -once -push-only myserver
+  unisync -once -pull-only myserver
+    only copies changes one way, what changed on the other side is left for a later sync
+    the side it copies from wins conflicts, but a file it deleted that changed on the other side
+    is only reported as a conflict
+    direction = push or direction = pull in the config do the same
+
+  unisync -status
+    lists instances running in the background
+
+  unisync -status myserver
+    shows what a running instance is doing: connection state, last sync, current transfer, recent errors
+
+  unisync -stop myserver
+    stops an instance running in the background, once it finishes the file it's transferring
+    Ctrl-C and kill do the same for one in the foreground, press Ctrl-C twice to stop right away
+
+  unisync -bwlimit 500:2000 myserver
+    tells a running instance to limit transfers to 500 KB/s up and 2000 KB/s down, until it exits
+    0 means no limit. bwlimit_up and bwlimit_down in the config do the same from the start
+
+  log = ~/unisync.log (in the config)
+    also logs to that file, which now rotates once it reaches 10 MB, keeping 5 old ones as unisync.log.1, ...
+    log_max_size = 0 or log_max_files = 0 turns that off, log_compress = true gzips the old ones
+    in the background or as a service, kill -HUP reopens it after something else rotated it
+
+  unisync -install-service myserver
+  unisync -uninstall-service myserver
+    runs myserver as a service that starts on login and restarts if it fails
+    uses a systemd user unit on linux, and a launchd agent on macOS
+
+  unisync -syncnow myserver
+    tells a running instance to sync right away
+
+  unisync -pause myserver
+  unisync -resume myserver
+    stops a running instance from syncing (it stays connected and keeps track of changes)
+    then syncs everything at once when resumed -- handy during a big git rebase
+    on unix, kill -USR1 and kill -USR2 do the same
+    with max_delete set, a sync that would delete more files than that pauses instead, -resume goes ahead
 
   unisync -server 18744
     runs a direct server, listening on port 18744
     use a client with method=directtls to connect to it
 
+  unisync -server 18744 -tokens tokens.txt
+    same, but clients without secure.key can connect with a token instead
+    tokens.txt has one hash per line, make them with: unisync -hashtoken [token]
+    the client needs token=[token] and tls_fingerprint=[printed by the server]
+
+  unisync -server unix:/path/to/unisync.sock
+    runs a server on a unix socket, only reachable by users who can access the socket file
+    use a client with method=unix and socket=/path/to/unisync.sock to connect to it
+
+  unisync -server tcp:127.0.0.1:18744
+    runs a server with no encryption or authentication, meant for loopback only
+    use a client with method=tcp to connect to it
+
+  unisync -server 18744 -allow-hooks
+    also runs hook_post_sync_remote and on_change from the clients' configs, after they change files here
+    only use it if you trust everyone who can connect, servers started over ssh always run hooks
+
+  unisync -server 18744 -metrics-listen 127.0.0.1:9750
+    also serves metrics for Prometheus at http://127.0.0.1:9750/metrics
+    metrics_listen = 127.0.0.1:9750 in a client's config does the same for the client
+
 `
 
 	fmt.Fprintf(os.Stderr, help)
@@ -0,0 +1,102 @@
+// Package hooks runs the hook_* and on_change commands from the config around a sync.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unisync/log"
+	"unisync/shell"
+)
+
+// a hook that takes longer than this is killed
+var Timeout = 5 * time.Minute
+
+// how much of a failed hook's output goes into the error
+var maxOutput = 1000
+
+// Run runs command in dir, with the changed paths on stdin, one per line
+// name is the setting it came from, for logs and errors
+// each line the command prints is passed to output as it comes, or logged as debug if output is nil
+func Run(name, command, dir string, paths []string, output func(line string)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	log.Debugf("Running %v for %v changes", name, len(paths))
+	start := time.Now()
+
+	if output == nil {
+		output = func(line string) {
+			log.Debugf("[%v] %v", name, line)
+		}
+	}
+	lines := &lineWriter{output: output}
+
+	cmd := shell.Command(ctx, command)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+	cmd.Stdout = lines
+	cmd.Stderr = lines
+	cmd.Env = append(os.Environ(),
+		"UNISYNC_HOOK="+name,
+		"UNISYNC_BASEPATH="+dir,
+		fmt.Sprintf("UNISYNC_CHANGED_COUNT=%v", len(paths)),
+	)
+	err := cmd.Run()
+	lines.flush()
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("%v timed out after %v", name, Timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%v failed: %v: %s", name, err, bytes.TrimSpace(lines.tail))
+	}
+
+	log.Debugf("%v done in %v", name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// passes what's written to it on line by line, and keeps the last maxOutput bytes for errors
+// stdout and stderr both write to it, from goroutines of their own
+type lineWriter struct {
+	mutex  sync.Mutex
+	output func(line string)
+	buf    []byte
+	tail   []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.tail = append(w.tail, p...)
+	if len(w.tail) > maxOutput {
+		w.tail = w.tail[len(w.tail)-maxOutput:]
+	}
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.output(strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// the last line, if it didn't end with a newline
+func (w *lineWriter) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.buf) > 0 {
+		w.output(string(w.buf))
+		w.buf = nil
+	}
+}
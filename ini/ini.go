@@ -2,6 +2,8 @@ package ini
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -9,8 +11,29 @@ import (
 
 type typeMapFn func(string) (reflect.Value, error)
 
+// tells whether the lines of a [section] apply, or why the section is invalid
+type sectionFn func(string) (bool, error)
+
+// refuses a key = value line, e.g. settings that aren't allowed in some file
+type filterFn func(key, value string) error
+
+// a file that includes itself would otherwise go on forever
+var maxIncludeDepth = 10
+
 type Parser struct {
-	typeMap map[string]typeMapFn
+	typeMap     map[string]typeMapFn
+	sections    sectionFn
+	includeDir  string
+	includePath func(string) string
+	lookupEnv   func(string) (string, bool)
+	filter      filterFn
+}
+
+// a struct field to set, from its `ini:"name"` tag
+// `ini:"name,noexpand"` leaves ${VAR} as is, for commands that get their own environment
+type setting struct {
+	value    reflect.Value
+	noExpand bool
 }
 
 type Unmarshaler interface {
@@ -29,15 +52,57 @@ func (p *Parser) AddTypeMap(key string, fn typeMapFn) {
 	p.typeMap[key] = fn
 }
 
+// SetSections enables [section] lines, fn tells which ones apply
+// lines before the first [section] of each file always apply
+// without it, [section] lines are ignored
+func (p *Parser) SetSections(fn sectionFn) {
+	p.sections = fn
+}
+
+// SetIncludeDir enables "include = other.conf", relative paths are relative to dir
+// expandPath can be nil, or turn paths like ~/other.conf into real ones before that
+func (p *Parser) SetIncludeDir(dir string, expandPath func(string) string) {
+	p.includeDir = dir
+	p.includePath = expandPath
+}
+
+// SetEnv enables ${VAR} and ${VAR:-default} in values, looked up with fn (like os.LookupEnv)
+// $${VAR} is left as ${VAR}, and so is everything in noexpand fields
+func (p *Parser) SetEnv(fn func(string) (string, bool)) {
+	p.lookupEnv = fn
+}
+
+// SetFilter has Unmarshal fail on lines that fn returns an error for, include lines too
+// it can be changed between calls to Unmarshal, to treat some data differently
+func (p *Parser) SetFilter(fn filterFn) {
+	p.filter = fn
+}
+
 func (p *Parser) Unmarshal(data []byte, ptr any) error {
 	fieldMap, err := p.makeFieldMap(ptr)
 	if err != nil {
 		return err
 	}
 
+	return p.unmarshal(data, fieldMap, 0)
+}
+
+func (p *Parser) unmarshal(data []byte, fieldMap map[string]setting, depth int) error {
+	applies := true
+
 	lines := strings.Split(string(data), "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") && p.sections != nil {
+			var err error
+			applies, err = p.sections(strings.TrimSpace(line[1 : len(line)-1]))
+			if err != nil {
+				return fmt.Errorf("%v <-- %v", line, err)
+			}
+			continue
+		}
+
 		key, value, valid := strings.Cut(line, "=")
 		if !valid {
 			continue
@@ -50,13 +115,36 @@ func (p *Parser) Unmarshal(data []byte, ptr any) error {
 		if strings.ContainsAny(key, "#; ") {
 			continue
 		}
+		if !applies {
+			continue
+		}
 
-		v, ok := fieldMap[key]
-		if !ok {
+		f, ok := fieldMap[key]
+		isInclude := key == "include" && p.includeDir != ""
+		if !ok && !isInclude {
 			return fmt.Errorf("%v <-- invalid setting", line)
 		}
 
-		err = p.setValue(v, value)
+		if p.lookupEnv != nil && !f.noExpand {
+			var err error
+			value, err = p.expand(value)
+			if err != nil {
+				return fmt.Errorf("%v <-- %v", line, err)
+			}
+		}
+
+		if p.filter != nil {
+			if err := p.filter(key, value); err != nil {
+				return fmt.Errorf("%v <-- %v", line, err)
+			}
+		}
+
+		var err error
+		if isInclude {
+			err = p.include(value, fieldMap, depth)
+		} else {
+			err = p.setValue(f.value, value)
+		}
 		if err != nil {
 			return fmt.Errorf("%v <-- %v", line, err)
 		}
@@ -65,6 +153,61 @@ func (p *Parser) Unmarshal(data []byte, ptr any) error {
 	return nil
 }
 
+func (p *Parser) include(path string, fieldMap map[string]setting, depth int) error {
+	if depth >= maxIncludeDepth {
+		return fmt.Errorf("too many nested includes")
+	}
+	if p.includePath != nil {
+		path = p.includePath(path)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.includeDir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = p.unmarshal(data, fieldMap, depth+1)
+	if err != nil {
+		return fmt.Errorf("in %v: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func (p *Parser) expand(value string) (string, error) {
+	var expanded strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			expanded.WriteString(value)
+			return expanded.String(), nil
+		}
+		if start > 0 && value[start-1] == '$' {
+			expanded.WriteString(value[:start-1] + "${")
+			value = value[start+2:]
+			continue
+		}
+
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("missing } after ${")
+		}
+		name, fallback, hasFallback := strings.Cut(value[start+2:start+end], ":-")
+
+		env, ok := p.lookupEnv(name)
+		if hasFallback && env == "" {
+			env = fallback
+		} else if !ok {
+			return "", fmt.Errorf("environment variable %v is not set, use ${%v:-default} if it's optional", name, name)
+		}
+
+		expanded.WriteString(value[:start] + env)
+		value = value[start+end+1:]
+	}
+}
+
 func (p *Parser) setValue(v reflect.Value, str string) error {
 	if v.CanConvert(unmarshalerType) {
 		if v.IsNil() {
@@ -132,8 +275,8 @@ func (p *Parser) getValue(str string, typ reflect.Type) (reflect.Value, error) {
 	return reflect.Value{}, fmt.Errorf("unknown type %v", typ)
 }
 
-func (p *Parser) makeFieldMap(ptr any) (map[string]reflect.Value, error) {
-	fieldMap := map[string]reflect.Value{}
+func (p *Parser) makeFieldMap(ptr any) (map[string]setting, error) {
+	fieldMap := map[string]setting{}
 
 	v := reflect.ValueOf(ptr)
 	for v.Type().Kind() == reflect.Pointer {
@@ -156,14 +299,14 @@ func (p *Parser) makeFieldMap(ptr any) (map[string]reflect.Value, error) {
 			return nil, fmt.Errorf("can't set struct values -- did you remember to pass a pointer?")
 		}
 
-		var name string
+		var name, options string
 		if tagName := field.Tag.Get("ini"); tagName != "" {
-			name, _, _ = strings.Cut(strings.ToLower(tagName), ",")
+			name, options, _ = strings.Cut(strings.ToLower(tagName), ",")
 		} else {
 			name = strings.ToLower(field.Name)
 		}
 
-		fieldMap[name] = fieldVal
+		fieldMap[name] = setting{value: fieldVal, noExpand: options == "noexpand"}
 	}
 
 	return fieldMap, nil
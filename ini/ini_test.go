@@ -0,0 +1,121 @@
+package ini
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testConfig struct {
+	Host   string   `ini:"host"`
+	User   string   `ini:"user"`
+	Ignore []string `ini:"ignore"`
+	Hook   string   `ini:"hook,noexpand"`
+}
+
+func TestIncludeAndSections(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("common.conf", "user = common\nignore = .git\n[host:other]\nuser = other\n")
+	write("loop.conf", "include = loop.conf\n")
+
+	parser := func(host string) *Parser {
+		p := New()
+		p.SetIncludeDir(dir, nil)
+		p.SetSections(func(section string) (bool, error) {
+			kind, value, _ := strings.Cut(section, ":")
+			if kind != "host" {
+				return false, fmt.Errorf("unknown section")
+			}
+			return value == host, nil
+		})
+		return p
+	}
+
+	tests := []struct {
+		data string
+		host string
+		want testConfig
+	}{
+		// slices add up across includes, the last value wins for the rest
+		{"include = common.conf\nignore = *.log\nuser = me", "", testConfig{User: "me", Ignore: []string{".git", "*.log"}}},
+		{"user = me\ninclude = common.conf", "", testConfig{User: "common", Ignore: []string{".git"}}},
+
+		// only the sections for host apply, in included files too
+		{"include = common.conf", "other", testConfig{User: "other", Ignore: []string{".git"}}},
+		{"[host:a]\nuser = a\n[host:b]\nuser = b", "b", testConfig{User: "b"}},
+		{"[host:a]\ninclude = common.conf", "b", testConfig{}},
+	}
+
+	for _, test := range tests {
+		got := testConfig{}
+		if err := parser(test.host).Unmarshal([]byte(test.data), &got); err != nil {
+			t.Errorf("%q: %v", test.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q with host %q: got %+v, want %+v", test.data, test.host, got, test.want)
+		}
+	}
+
+	for _, data := range []string{"include = loop.conf", "include = missing.conf", "[other]\nuser = me"} {
+		if err := parser("").Unmarshal([]byte(data), &testConfig{}); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{"USER": "me", "EMPTY": ""}
+	p := New()
+	p.SetEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"${USER}", "me"},
+		{"/home/${USER}/${USER}", "/home/me/me"},
+		{"${MISSING:-/srv}/app", "/srv/app"},
+		{"${EMPTY:-default}", "default"},
+		{"${EMPTY}", ""},
+		{"$${USER} $USER", "${USER} $USER"},
+	}
+
+	for _, test := range tests {
+		got := testConfig{}
+		if err := p.Unmarshal([]byte("user = "+test.value), &got); err != nil {
+			t.Errorf("%q: %v", test.value, err)
+			continue
+		}
+		if got.User != test.want {
+			t.Errorf("%q: got %q, want %q", test.value, got.User, test.want)
+		}
+	}
+
+	for _, value := range []string{"${MISSING}", "${USER"} {
+		err := p.Unmarshal([]byte("user = "+value), &testConfig{})
+		if err == nil || !strings.Contains(err.Error(), value) {
+			t.Errorf("%q: expected an error naming the line, got %v", value, err)
+		}
+	}
+
+	// commands get their own environment when they run
+	got := testConfig{}
+	if err := p.Unmarshal([]byte("hook = echo ${MISSING} $${USER}"), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Hook != "echo ${MISSING} $${USER}" {
+		t.Errorf("noexpand: got %q", got.Hook)
+	}
+}
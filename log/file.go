@@ -0,0 +1,190 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// when a log file gets rotated, see AddFile
+type Rotation struct {
+	// in bytes, 0 to never rotate
+	MaxSize int64
+	// how many rotated files to keep, as path.1, path.2, ..., 0 to never rotate
+	MaxFiles int
+	// gzip rotated files, as path.1.gz, path.2.gz, ...
+	Compress bool
+}
+
+// a log file that rotates itself, and that can be reopened after something else rotated it
+type File struct {
+	Rotation
+
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+
+	// compressing a rotated file happens in the background, so logging doesn't wait for it
+	compressing sync.WaitGroup
+}
+
+func OpenFile(path string, rotation Rotation) (*File, error) {
+	f := &File{Rotation: rotation, path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.MaxSize > 0 && f.MaxFiles > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		if err := f.rotate(); err != nil {
+			// better to keep logging to a file that's too big than to stop
+			// try again once it has grown by another MaxSize, not on every write
+			fmt.Fprintln(os.Stderr, "Unable to rotate log:", err)
+			f.size = 0
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen opens the file again, for when logrotate has moved it away
+// if that fails, logging goes on to the old one
+func (f *File) Reopen() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.open()
+}
+
+func (f *File) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.compressing.Wait()
+	return f.file.Close()
+}
+
+// opens path and only then closes the file we had, so if that fails we keep logging to it
+// mutex must be held
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// mutex must be held
+func (f *File) rotate() error {
+	// the last rotated file has to be compressed before it moves on
+	f.compressing.Wait()
+
+	// windows can't rename a file that's open, elsewhere we keep it open in case open() fails
+	current := f.path
+	if runtime.GOOS == "windows" {
+		f.file.Close()
+	}
+
+	// path.4 -> path.5, ..., path -> path.1
+	// whatever is at path.MaxFiles gets overwritten, compressed or not
+	for i := f.MaxFiles - 1; i >= 0; i-- {
+		from, to := f.rotatedPath(i), f.rotatedPath(i+1)
+		ext := ""
+		if _, err := os.Stat(from); err == nil {
+			// if there's both, compressing it was cut short
+			if i > 0 {
+				os.Remove(from + ".gz")
+			}
+		} else if _, err := os.Stat(from + ".gz"); err == nil && i > 0 {
+			ext = ".gz"
+		} else {
+			continue
+		}
+
+		// so there's only one of each number, even after log_compress was changed
+		os.Remove(to)
+		os.Remove(to + ".gz")
+		if err := os.Rename(from+ext, to+ext); err == nil && i == 0 {
+			current = to
+		}
+	}
+
+	if err := f.open(); err != nil {
+		if runtime.GOOS == "windows" {
+			if file, err := os.OpenFile(current, os.O_APPEND|os.O_WRONLY, 0644); err == nil {
+				f.file = file
+			}
+		}
+		return err
+	}
+
+	if f.Compress {
+		f.compressing.Add(1)
+		go func() {
+			defer f.compressing.Done()
+			if err := compress(f.rotatedPath(1)); err != nil {
+				fmt.Fprintln(os.Stderr, "Unable to compress rotated log:", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+func (f *File) rotatedPath(i int) string {
+	if i == 0 {
+		return f.path
+	}
+	return fmt.Sprintf("%v.%v", f.path, i)
+}
+
+// replaces path with path.gz
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -1,10 +1,12 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,55 +17,161 @@ const (
 	Fatal
 )
 
+var levelNames = []string{"debug", "notice", "warn", "fatal"}
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
 type Output struct {
 	Writer    io.Writer
 	Level     uint8
 	Timestamp string
+
+	// FormatText or FormatJSON, text if empty
+	Format string
+
+	// also write protocol traces (see Tracef), whatever the Level
+	Trace bool
 }
 
 var ScreenOutput io.Writer = os.Stdout
 var ScreenLevel uint8 = Notice
 var ScreenTimestmap = ""
+var ScreenFormat = FormatText
+var ScreenTrace = false
+
+// added to every json line, so the logs of several instances can be told apart
+var Session = ""
 
 var Outputs = []*Output{}
 
-func writeTo(w io.Writer, ts, str string) {
-	str = strings.TrimSpace(str)
+// so lines from different goroutines don't get mixed up
+var mutex sync.Mutex
+
+// the structured parts of a line, only written out separately with FormatJSON
+type Fields struct {
+	// "->" for local to remote, "<-" for remote to local, "<->" for both
+	Direction string
+	// like "PUSH", "PULL", "DEL", "MKDIR", "CONFLICT"
+	Action string
+	Path   string
+	Size   int64
+	Err    error
+}
 
-	if ts != "" {
-		ts = time.Now().Format(ts)
-		io.WriteString(w, ts+" "+str+"\n")
+type jsonLine struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Session   string `json:"session,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+	Err       string `json:"error,omitempty"`
+	Msg       string `json:"msg"`
+}
+
+func (o *Output) wants(level uint8, trace bool) bool {
+	if trace {
+		return o.Trace
+	}
+	return level >= o.Level
+}
+
+func (o *Output) write(now time.Time, level uint8, trace bool, fields *Fields, str string) {
+	if o.Format == FormatJSON {
+		line := jsonLine{
+			Time:    now.Format("2006-01-02T15:04:05.000Z07:00"),
+			Level:   levelNames[level],
+			Session: Session,
+			Msg:     str,
+		}
+		if trace {
+			line.Level = "trace"
+		}
+		if fields != nil {
+			line.Direction = fields.Direction
+			line.Action = fields.Action
+			line.Path = fields.Path
+			line.Size = fields.Size
+			if fields.Err != nil {
+				line.Err = fields.Err.Error()
+			}
+		}
+
+		// Encode() adds the newline, and we'd rather keep "->" readable
+		encoder := json.NewEncoder(o.Writer)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(line)
+		return
+	}
+
+	if o.Timestamp != "" {
+		io.WriteString(o.Writer, now.Format(o.Timestamp)+" "+str+"\n")
 	} else {
-		io.WriteString(w, str+"\n")
+		io.WriteString(o.Writer, str+"\n")
 	}
 }
 
-func write(level uint8, str string) {
-	if ScreenOutput != nil && level >= ScreenLevel {
-		writeTo(ScreenOutput, ScreenTimestmap, str)
+func write(level uint8, trace bool, fields *Fields, str string) {
+	str = strings.TrimSpace(str)
+	now := time.Now()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if ScreenOutput != nil {
+		screen := &Output{ScreenOutput, ScreenLevel, ScreenTimestmap, ScreenFormat, ScreenTrace}
+		if screen.wants(level, trace) {
+			screen.write(now, level, trace, fields, str)
+		}
 	}
 
 	for _, output := range Outputs {
-		if level >= output.Level {
-			writeTo(output.Writer, output.Timestamp, str)
+		if output.wants(level, trace) {
+			output.write(now, level, trace, fields, str)
 		}
 	}
 }
 
-func Add(w io.Writer, level uint8, ts string) {
-	Outputs = append(Outputs, &Output{w, level, ts})
+func Add(w io.Writer, level uint8, ts string) *Output {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	output := &Output{Writer: w, Level: level, Timestamp: ts}
+	Outputs = append(Outputs, output)
+	return output
 }
 
-func AddFile(fullpath string, level uint8, ts string) error {
-	file, err := os.OpenFile(fullpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// the returned Output can be changed, to set its Format for example
+func AddFile(fullpath string, level uint8, ts string, rotation Rotation) (*Output, error) {
+	file, err := OpenFile(fullpath, rotation)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return Add(file, level, ts), nil
+}
+
+// Reopen reopens every file added with AddFile(), for when logrotate has moved them away
+func Reopen() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, output := range Outputs {
+		if file, ok := output.Writer.(*File); ok {
+			if err := file.Reopen(); err != nil {
+				return err
+			}
+		}
 	}
-	Add(file, level, ts)
 	return nil
 }
 
 func Reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
 	Outputs = []*Output{}
 }
 
@@ -77,30 +185,81 @@ func Reset() {
 // 	return 0, false
 // }
 
+// ParseLevel turns "debug", "notice" or "warn" into Debug, Notice or Warn
+func ParseLevel(name string) (uint8, error) {
+	for level, levelName := range levelNames {
+		if name == levelName && level != Fatal {
+			return uint8(level), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %v, should be debug, notice or warn", name)
+}
+
+// With adds fields to a line, for outputs with FormatJSON:
+//
+//	log.With(log.Fields{Path: path, Err: err}).Warnf("Unable to sync %v: %v", path, err)
+func With(fields Fields) *Fields {
+	return &fields
+}
+
+func (f *Fields) Println(a ...any) {
+	write(Notice, false, f, fmt.Sprintln(a...))
+}
+func (f *Fields) Warnln(a ...any) {
+	write(Warn, false, f, fmt.Sprintln(a...))
+}
+func (f *Fields) Printf(format string, a ...any) {
+	write(Notice, false, f, fmt.Sprintf(format, a...))
+}
+func (f *Fields) Warnf(format string, a ...any) {
+	write(Warn, false, f, fmt.Sprintf(format, a...))
+}
+
+// Action logs something done to a file, like "-> DEL some/file"
+func Action(direction, action, path string, extra ...any) {
+	a := append([]any{direction, action, path}, extra...)
+	With(Fields{Direction: direction, Action: action, Path: path}).Println(a...)
+}
+
+// Transfer logs a file being pushed ("->") or pulled ("<-"), like "-> some/file"
+func Transfer(direction, path string, size int64) {
+	action := "PUSH"
+	if direction == "<-" {
+		action = "PULL"
+	}
+	With(Fields{Direction: direction, Action: action, Path: path, Size: size}).Println(direction, path)
+}
+
+// Tracef is for the protocol traces, which are only written to outputs with Trace set,
+// whatever their level
+func Tracef(format string, a ...any) {
+	write(Debug, true, nil, fmt.Sprintf(format, a...))
+}
+
 func Debugln(a ...any) {
-	write(Debug, fmt.Sprintln(a...))
+	write(Debug, false, nil, fmt.Sprintln(a...))
 }
 func Println(a ...any) {
-	write(Notice, fmt.Sprintln(a...))
+	write(Notice, false, nil, fmt.Sprintln(a...))
 }
 func Warnln(a ...any) {
-	write(Warn, fmt.Sprintln(a...))
+	write(Warn, false, nil, fmt.Sprintln(a...))
 }
 func Fatalln(a ...any) {
-	write(Fatal, fmt.Sprintln(a...))
+	write(Fatal, false, nil, fmt.Sprintln(a...))
 	os.Exit(1)
 }
 
 func Debugf(format string, a ...any) {
-	write(Debug, fmt.Sprintf(format, a...))
+	write(Debug, false, nil, fmt.Sprintf(format, a...))
 }
 func Printf(format string, a ...any) {
-	write(Notice, fmt.Sprintf(format, a...))
+	write(Notice, false, nil, fmt.Sprintf(format, a...))
 }
 func Warnf(format string, a ...any) {
-	write(Warn, fmt.Sprintf(format, a...))
+	write(Warn, false, nil, fmt.Sprintf(format, a...))
 }
 func Fatalf(format string, a ...any) {
-	write(Fatal, fmt.Sprintf(format, a...))
+	write(Fatal, false, nil, fmt.Sprintf(format, a...))
 	os.Exit(1)
 }
@@ -0,0 +1,181 @@
+// Package metrics keeps a few counters and gauges, and serves them over http
+// in the OpenMetrics text format, so Prometheus and the like can scrape them.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unisync/log"
+)
+
+const contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+var familiesLock sync.Mutex
+var families []*family
+
+// all the samples of one metric, with at most one label
+type family struct {
+	name  string
+	help  string
+	typ   string
+	label string
+
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+func register(name, help, typ, label string) *family {
+	f := &family{name: name, help: help, typ: typ, label: label, values: map[string]float64{}}
+	if label == "" {
+		// show up as 0 rather than not at all
+		f.values[""] = 0
+	}
+
+	familiesLock.Lock()
+	defer familiesLock.Unlock()
+	families = append(families, f)
+	return f
+}
+
+func (f *family) add(labelValue string, v float64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.values[labelValue] += v
+}
+
+func (f *family) set(labelValue string, v float64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.values[labelValue] = v
+}
+
+func (f *family) write(w io.Writer) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	_, err := fmt.Fprintf(w, "# TYPE %v %v\n# HELP %v %v\n", f.name, f.typ, f.name, f.help)
+	if err != nil {
+		return err
+	}
+
+	sample := f.name
+	if f.typ == "counter" {
+		sample += "_total"
+	}
+
+	labelValues := make([]string, 0, len(f.values))
+	for labelValue := range f.values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+
+	for _, labelValue := range labelValues {
+		labels := ""
+		if f.label != "" {
+			labels = fmt.Sprintf("{%v=\"%v\"}", f.label, escape(labelValue))
+		}
+		_, err = fmt.Fprintf(w, "%v%v %v\n", sample, labels, strconv.FormatFloat(f.values[labelValue], 'f', -1, 64))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func escape(str string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(str)
+}
+
+// only goes up, except when the process restarts
+type Counter struct {
+	f          *family
+	labelValue string
+}
+
+func NewCounter(name, help string) Counter {
+	return Counter{f: register(name, help, "counter", "")}
+}
+
+func (c Counter) Inc() {
+	c.f.add(c.labelValue, 1)
+}
+
+func (c Counter) Add(v float64) {
+	c.f.add(c.labelValue, v)
+}
+
+// a counter for each value of label
+type CounterVec struct {
+	f *family
+}
+
+func NewCounterVec(name, help, label string) CounterVec {
+	return CounterVec{f: register(name, help, "counter", label)}
+}
+
+func (c CounterVec) With(labelValue string) Counter {
+	return Counter{f: c.f, labelValue: labelValue}
+}
+
+// can go up and down
+type Gauge struct {
+	f *family
+}
+
+func NewGauge(name, help string) Gauge {
+	return Gauge{f: register(name, help, "gauge", "")}
+}
+
+func (g Gauge) Set(v float64) {
+	g.f.set("", v)
+}
+
+func (g Gauge) Add(v float64) {
+	g.f.add("", v)
+}
+
+func (g Gauge) SetToCurrentTime() {
+	g.Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+// Write writes every metric in the OpenMetrics text format
+func Write(w io.Writer) error {
+	familiesLock.Lock()
+	defer familiesLock.Unlock()
+
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+// Serve listens at addr ([host]:port), and serves the metrics at /metrics until the process exits
+// it only returns an error if it can't listen
+func Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("Unable to serve metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		Write(w)
+	})
+
+	log.Printf("Serving metrics at http://%v/metrics", listener.Addr())
+	go http.Serve(listener, mux)
+	return nil
+}
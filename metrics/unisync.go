@@ -0,0 +1,29 @@
+package metrics
+
+// the client and the server both update whichever of these apply to them
+var (
+	Syncs = NewCounter("unisync_syncs",
+		"Syncs completed.")
+	TransferredBytes = NewCounterVec("unisync_transferred_bytes",
+		"Bytes of file contents transferred, by direction (sent or received).", "direction")
+	Errors = NewCounterVec("unisync_errors",
+		"Errors that dropped a connection, by type (auth, network, remote or other).", "type")
+	Reconnects = NewCounter("unisync_reconnects",
+		"Times the client tried to reconnect after a failure.")
+	Connections = NewGauge("unisync_connections",
+		"Connections currently open, 0 or 1 for a client.")
+	LastSync = NewGauge("unisync_last_sync_timestamp_seconds",
+		"When the last sync completed, or when the server last listed its files.")
+	Files = NewGauge("unisync_files",
+		"Files, folders and symlinks seen by the last scan.")
+	ScanDuration = NewGauge("unisync_scan_duration_seconds",
+		"How long the last scan took.")
+	WatcherEventsDropped = NewCounter("unisync_watcher_events_dropped",
+		"Filesystem events discarded because the watcher's buffer was full.")
+)
+
+// the directions for TransferredBytes
+const (
+	Sent     = "sent"
+	Received = "received"
+)
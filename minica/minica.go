@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
@@ -54,6 +55,11 @@ func (m *MiniCA) GetCAPool() *x509.CertPool {
 	return pool
 }
 
+// clients without the key can pin this instead (see tls_fingerprint)
+func (m *MiniCA) Fingerprint() string {
+	return fmt.Sprintf("%x", sha256.Sum256(m.caCert.Raw))
+}
+
 func (m *MiniCA) GetCert() ([]tls.Certificate, error) {
 	if m.serverCert == nil {
 		var err error
@@ -108,6 +114,10 @@ func (m *MiniCA) makeCert() ([]tls.Certificate, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// the cert itself is regenerated on every run, so send the CA along with it
+	// that way clients can pin the CA's fingerprint
+	serverCert.Certificate = append(serverCert.Certificate, m.caCert.Raw)
 	return []tls.Certificate{serverCert}, nil
 }
 
@@ -0,0 +1,18 @@
+package node
+
+import "sync/atomic"
+
+// SetBwlimit limits how fast SendFile() sends, and tells us how fast the other side
+// is allowed to send to us (which only matters for ETAs), both in bytes per second
+func (n *Node) SetBwlimit(send, recv int64) {
+	n.sendLimit.SetRate(send)
+	atomic.StoreInt64(n.recvLimit, recv)
+}
+
+func (n *Node) SendLimit() int64 {
+	return n.sendLimit.Rate()
+}
+
+func (n *Node) RecvLimit() int64 {
+	return atomic.LoadInt64(n.recvLimit)
+}
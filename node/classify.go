@@ -0,0 +1,69 @@
+package node
+
+import (
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// why a connection ended, for logs, session.Status() and metrics
+const (
+	ReasonAuth    = "auth"
+	ReasonNetwork = "network"
+	ReasonRemote  = "remote"
+	ReasonOther   = "other"
+)
+
+// for reasons to reconnect that don't come from the connection itself, see NewNetworkError
+type networkError struct {
+	msg string
+}
+
+func (e *networkError) Error() string {
+	return e.msg
+}
+
+// NewNetworkError makes an error that Classify counts as ReasonNetwork
+func NewNetworkError(msg string) error {
+	return &networkError{msg: msg}
+}
+
+// Classify tells which of the Reason constants err is
+func Classify(err error) string {
+	var remoteErr *RemoteError
+	var networkErr *networkError
+	var netErr net.Error
+	var unknownAuthority x509.UnknownAuthorityError
+	var certInvalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+
+	msg := strings.ToLower(err.Error())
+	contains := func(strs ...string) bool {
+		for _, str := range strs {
+			if strings.Contains(msg, str) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &certInvalid), errors.As(err, &hostname),
+		contains("authentication failed", "unable to authenticate", "permission denied (publickey", "fingerprint", "bad certificate"):
+		return ReasonAuth
+
+	case errors.As(err, &remoteErr):
+		return ReasonRemote
+
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.As(err, &networkErr),
+		contains("connection closed", "connection refused", "connection reset", "broken pipe", "no route to host", "timeout", "timed out"):
+		return ReasonNetwork
+	}
+
+	return ReasonOther
+}
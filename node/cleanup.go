@@ -0,0 +1,51 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+	"unisync/filelist"
+	"unisync/log"
+)
+
+// removes temp files left behind by transfers that were interrupted by a crash
+// they're either in tmpdir or next to the file they were for, so this only looks in tmpdir,
+// basepath and the folders in list, rather than in everything under basepath
+// files modified in the last maxAge are left alone, in case someone else is still writing them
+// partials (see CanResume) are kept until they're older than partial_expire
+func (n *Node) CleanTmpFiles(list filelist.FileList, maxAge time.Duration) {
+	partialMaxAge := maxAge
+	if n.Config.PartialExpire > partialMaxAge {
+		partialMaxAge = n.Config.PartialExpire
+	}
+
+	cleanDir := func(dir string) {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() || !filelist.IsTmpFile(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			path := filepath.Join(dir, entry.Name())
+			age := time.Since(info.ModTime())
+			if age >= maxAge && (!isPartialFile(path) || age >= partialMaxAge) {
+				log.Debugln("Removing stale temp file:", path)
+				os.Remove(path)
+			}
+		}
+	}
+
+	if tmpdir := n.GetTmpdir(); tmpdir != "" {
+		cleanDir(tmpdir)
+	}
+	cleanDir(n.GetBasepath())
+	for _, item := range list {
+		if item.IsDir {
+			cleanDir(n.Path(item.Path))
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package node
+
+import "sync/atomic"
+
+// in its own struct, so the int64s are aligned for atomic on 32 bit platforms
+type counters struct {
+	sent     int64
+	received int64
+}
+
+// bytes of file contents sent with SendFile() since the connection started
+func (n *Node) BytesSent() int64 {
+	return atomic.LoadInt64(&n.counters.sent)
+}
+
+// bytes of file contents received with ReceiveFile() since the connection started
+func (n *Node) BytesReceived() int64 {
+	return atomic.LoadInt64(&n.counters.received)
+}
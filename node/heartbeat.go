@@ -0,0 +1,110 @@
+package node
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+	"unisync/commands"
+	"unisync/log"
+)
+
+// how many heartbeat intervals can go by without hearing anything from
+// the other side, before we decide the connection is dead
+var heartbeatMisses = 4
+
+// accessed atomically, keep the int64s first for alignment on 32-bit
+type heartbeat struct {
+	// unix nanoseconds
+	lastRead int64
+	latency  int64
+}
+
+// records when we last heard from the other side
+type activityReader struct {
+	r         io.Reader
+	heartbeat *heartbeat
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		atomic.StoreInt64(&a.heartbeat.lastRead, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// StartHeartbeat sends PING every interval, and calls SetDone() if nothing at all
+// has come in for a few intervals. Only use it if the other side has commands.CapPing.
+// PING and PONG must be routed to SideC, and passed to HandleHeartbeat().
+func (n *Node) StartHeartbeat(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go n.heartbeatLoop(interval)
+}
+
+// separate goroutine
+func (n *Node) heartbeatLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	timeout := interval * time.Duration(heartbeatMisses)
+
+	for {
+		select {
+		case <-n.doneC:
+			return
+		case <-ticker.C:
+		}
+
+		lastRead := time.Unix(0, atomic.LoadInt64(&n.heartbeat.lastRead))
+		if since := time.Since(lastRead); since > timeout {
+			err := fmt.Errorf("connection timed out: nothing received for %v", since.Round(time.Second))
+			if latency := n.Latency(); latency > 0 {
+				err = fmt.Errorf("%w (latency was %v)", err, RoundLatency(latency))
+			}
+			n.SetDone(err)
+			if n.inCloser != nil {
+				n.inCloser.Close()
+			}
+			return
+		}
+
+		// if something else is being written, the other side is hearing from us anyway
+		_, err := n.TrySendCmd(&commands.Ping{Sent: time.Now().UnixNano()})
+		if err != nil {
+			n.SetDone(err)
+			return
+		}
+	}
+}
+
+func (n *Node) HandleHeartbeat(cmd commands.Command) error {
+	switch cmd := cmd.(type) {
+	case *commands.Ping:
+		// don't wait for a file transfer to finish, InputReader would be stuck behind us
+		_, err := n.TrySendCmd(&commands.Pong{Sent: cmd.Sent})
+		return err
+
+	case *commands.Pong:
+		latency := time.Since(time.Unix(0, cmd.Sent))
+		atomic.StoreInt64(&n.heartbeat.latency, int64(latency))
+		log.Tracef("latency: %v", RoundLatency(latency))
+	}
+
+	return nil
+}
+
+// round trip time of the last PING, or 0 if we don't know yet
+func (n *Node) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&n.heartbeat.latency))
+}
+
+// to ms, unless it's less than that
+func RoundLatency(latency time.Duration) time.Duration {
+	if latency < time.Millisecond {
+		return latency.Round(time.Microsecond)
+	}
+	return latency.Round(time.Millisecond)
+}
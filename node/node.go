@@ -8,9 +8,11 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 	"unisync/config"
 	"unisync/done"
 	"unisync/progresswriter"
+	"unisync/ratelimit"
 	"unisync/watcher"
 )
 
@@ -24,6 +26,14 @@ type Node struct {
 	writeLock *sync.Mutex
 	tmpdir    string
 
+	// see SetBwlimit()
+	sendLimit *ratelimit.Limiter
+	recvLimit *int64
+
+	// keep partly received files, so transfers can be resumed (see CanResume)
+	// only set once both sides have agreed to it with commands.CapResume
+	ResumeTransfers bool
+
 	// watches for filesystem changes
 	// started by SetBasepath()
 	// can be stopped with Watcher.Stop()
@@ -47,6 +57,14 @@ type Node struct {
 	SetDone func(error)
 	IsDone  func() error
 	DoneC   func() chan error
+	doneC   chan error
+
+	// closing In is the only way to stop a read from a dead connection
+	inCloser  io.Closer
+	heartbeat *heartbeat
+
+	// see BytesSent() and BytesReceived()
+	counters *counters
 }
 
 func New(in io.Reader, out io.Writer) *Node {
@@ -54,19 +72,28 @@ func New(in io.Reader, out io.Writer) *Node {
 		panic("Node: in and out can't be nil")
 	}
 
+	heartbeat := &heartbeat{lastRead: time.Now().UnixNano()}
 	node := &Node{
-		In:         bufio.NewReader(in),
+		In:         bufio.NewReader(&activityReader{r: in, heartbeat: heartbeat}),
 		Out:        out,
 		Buffer:     make([]byte, 1000000),
 		MainC:      make(chan *Packet),
 		SideC:      make(chan *Packet),
 		sideCmatch: map[string]struct{}{},
 		Watcher:    watcher.New(),
+		counters:   &counters{},
 		Progress:   make(chan progresswriter.Progress),
 		writeLock:  &sync.Mutex{},
+		heartbeat:  heartbeat,
+		sendLimit:  ratelimit.New(0),
+		recvLimit:  new(int64),
+	}
+	if closer, ok := in.(io.Closer); ok {
+		node.inCloser = closer
 	}
 
 	node.SetDone, node.IsDone, node.DoneC = done.New()
+	node.doneC = node.DoneC()
 	go node.InputReader()
 	return node
 }
@@ -0,0 +1,106 @@
+package node
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unisync/commands"
+)
+
+// partials still match filelist.TmpPattern, so they're never synced
+var partialPrefix = ".tmp-unisync-partial-"
+
+func isPartialFile(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), partialPrefix)
+}
+
+// where a partly received copy of this version of the file is kept
+func (n *Node) partialPath(path string, size, modifiedAt int64) string {
+	key := sha256.Sum256([]byte(fmt.Sprintf("%v\x00%v\x00%v", path, size, modifiedAt)))
+
+	dir := n.GetTmpdir()
+	if dir == "" {
+		dir = filepath.Dir(n.Path(path))
+	}
+	return filepath.Join(dir, fmt.Sprintf("%v%x.tmp", partialPrefix, key[:12]))
+}
+
+// CanResume is true if a transfer of this size will keep a partial file if it's interrupted
+// it's only worth it for files that take more than one chunk
+func (n *Node) CanResume(size int64) bool {
+	return n.ResumeTransfers && size > int64(len(n.Buffer))
+}
+
+// FindPartials returns the partials we have for these files, with Offset and Sum filled in
+func (n *Node) FindPartials(files []commands.Partial) []commands.Partial {
+	partials := []commands.Partial{}
+
+	for _, file := range files {
+		if !n.CanResume(file.Size) {
+			continue
+		}
+
+		partialpath := n.partialPath(file.Path, file.Size, file.ModifiedAt)
+		info, err := os.Stat(partialpath)
+		if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || info.Size() >= file.Size {
+			continue
+		}
+		if time.Since(info.ModTime()) > n.Config.PartialExpire {
+			os.Remove(partialpath)
+			continue
+		}
+
+		sum, err := prefixSum(partialpath, info.Size())
+		if err != nil {
+			continue
+		}
+
+		file.Offset = info.Size()
+		file.Sum = sum
+		partials = append(partials, file)
+	}
+
+	return partials
+}
+
+// where SendFile() can start from, given what the other side has
+func resumeOffset(filename string, info os.FileInfo, partial *commands.Partial) int64 {
+	if partial == nil || partial.Offset <= 0 || partial.Offset >= info.Size() {
+		return 0
+	}
+	if partial.Size != info.Size() || partial.ModifiedAt != info.ModTime().Unix() {
+		return 0
+	}
+
+	// make sure what they have is what we have
+	sum, err := prefixSum(filename, partial.Offset)
+	if err != nil || sum != partial.Sum {
+		return 0
+	}
+
+	return partial.Offset
+}
+
+// sha256 of the first length bytes of the file
+func prefixSum(filename string, length int64) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	copied, err := io.Copy(hash, io.LimitReader(file, length))
+	if err != nil {
+		return "", err
+	}
+	if copied != length {
+		return "", fmt.Errorf("%v is shorter than %v bytes", filename, length)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
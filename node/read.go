@@ -13,6 +13,15 @@ type Packet struct {
 	Waiter  *sync.WaitGroup
 }
 
+// an ERR sent by the other side
+type RemoteError struct {
+	Msg string
+}
+
+func (e *RemoteError) Error() string {
+	return "Server Sent Error: " + e.Msg
+}
+
 // separate goroutine
 func (n *Node) InputReader() {
 	var err error
@@ -28,7 +37,7 @@ func (n *Node) InputReader() {
 			continue
 		}
 
-		log.Debugf("<- %v\n", line)
+		log.Tracef("<- %v\n", line)
 
 		var cmd commands.Command
 		cmd, err = commands.Parse(line)
@@ -45,7 +54,7 @@ func (n *Node) InputReader() {
 
 		if cmd.CmdType() == "ERR" {
 			error := cmd.(*commands.Error)
-			err = fmt.Errorf("Server Sent Error: %v", error.Err)
+			err = &RemoteError{Msg: error.Err}
 			break
 
 		} else if _, exists := n.sideCmatch[cmd.CmdType()]; exists {
@@ -76,7 +85,15 @@ func (n *Node) SetSideC(matches ...string) {
 }
 
 func (n *Node) WaitFor(expectCmd string) (commands.Command, *sync.WaitGroup, error) {
-	packet, ok := <-n.MainC
+	var packet *Packet
+	var ok bool
+	select {
+	case packet, ok = <-n.MainC:
+	// MainC doesn't close until InputReader gives up, which might never
+	// happen if the connection died without closing
+	case <-n.doneC:
+	}
+
 	if !ok {
 		if err := n.IsDone(); err != nil {
 			return nil, nil, err
@@ -7,8 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unisync/commands"
+	"unisync/filelist"
+	"unisync/log"
+	"unisync/metrics"
 	"unisync/progresswriter"
 )
 
@@ -16,11 +20,20 @@ func (n *Node) ReceiveFile(push *commands.Push, waiter *sync.WaitGroup) error {
 	path := push.Path
 	fullpath := n.Path(path)
 	mtime := time.Unix(push.ModifiedAt, 0)
-	file, tempfullpath, err := n.openReceiveFile(fullpath, push.Mode.Perm(), push.Size)
+	file, tempfullpath, resumable, err := n.openReceiveFile(push)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(tempfullpath)
+	closed := false
+	defer func() {
+		if !closed {
+			file.Close()
+		}
+		// a partial is kept around in case we get disconnected, so we can resume next time
+		if !resumable {
+			os.Remove(tempfullpath)
+		}
+	}()
 
 	for {
 		if bodyLen := int64(push.BodyLen()); bodyLen > 0 {
@@ -28,6 +41,8 @@ func (n *Node) ReceiveFile(push *commands.Push, waiter *sync.WaitGroup) error {
 			if err != nil {
 				return err
 			}
+			atomic.AddInt64(&n.counters.received, bytesCopied)
+			metrics.TransferredBytes.With(metrics.Received).Add(float64(bytesCopied))
 			if bytesCopied != bodyLen {
 				return fmt.Errorf("size mismatch: %v (expected %v bytes in this chunk but got %v)", path, bodyLen, bytesCopied)
 			}
@@ -51,6 +66,7 @@ func (n *Node) ReceiveFile(push *commands.Push, waiter *sync.WaitGroup) error {
 		}
 	}
 
+	closed = true
 	err = file.Close()
 	if err != nil {
 		return err
@@ -67,11 +83,15 @@ func (n *Node) ReceiveFile(push *commands.Push, waiter *sync.WaitGroup) error {
 	return nil
 }
 
-func (n *Node) openReceiveFile(fullpath string, receivedPerm fs.FileMode, size int64) (io.WriteCloser, string, error) {
+// returns the file to write to, where it is, and whether it's a partial that should be kept
+// if we don't get the whole thing
+func (n *Node) openReceiveFile(push *commands.Push) (io.WriteCloser, string, bool, error) {
+	fullpath := n.Path(push.Path)
+
 	var perm fs.FileMode
 	if info, err := os.Lstat(fullpath); err == nil {
 		if info.Mode().IsDir() {
-			return nil, "", fmt.Errorf("can't RECEIVE %v: is a directory", fullpath)
+			return nil, "", false, fmt.Errorf("can't RECEIVE %v: is a directory", fullpath)
 		}
 		perm = info.Mode().Perm()
 	} else {
@@ -83,10 +103,28 @@ func (n *Node) openReceiveFile(fullpath string, receivedPerm fs.FileMode, size i
 	}
 
 	// if we got a mode of 0 (the sending side is Windows), just keep the mode we have
-	if receivedPerm != 0 {
+	if receivedPerm := push.Mode.Perm(); receivedPerm != 0 {
 		perm = n.FileMask(perm, receivedPerm)
 	}
 
+	if n.CanResume(push.Size) {
+		file, tempfullpath, err := n.openPartial(push)
+		if err != nil {
+			return nil, "", false, err
+		}
+		err = file.Chmod(perm)
+		if err != nil {
+			file.Close()
+			return nil, "", false, err
+		}
+		pw := progresswriter.NewAt(file, push.Offset, push.Size, n.Progress)
+		pw.SetLimit(n.RecvLimit)
+		return pw, tempfullpath, true, nil
+	}
+	if push.Offset != 0 {
+		return nil, "", false, fmt.Errorf("can't resume %v: we have no partial file", push.Path)
+	}
+
 	var tmpdir string
 	if n.GetTmpdir() != "" {
 		tmpdir = n.GetTmpdir()
@@ -94,14 +132,52 @@ func (n *Node) openReceiveFile(fullpath string, receivedPerm fs.FileMode, size i
 		tmpdir, _ = filepath.Split(fullpath)
 	}
 
-	file, err := os.CreateTemp(tmpdir, ".tmp-unisync-*.tmp")
+	file, err := os.CreateTemp(tmpdir, filelist.TmpPattern)
 	if err != nil {
-		return nil, "", err
+		return nil, "", false, err
 	}
 
 	err = file.Chmod(perm)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", false, err
+	}
+	pw := progresswriter.New(file, push.Size, n.Progress)
+	pw.SetLimit(n.RecvLimit)
+	return pw, file.Name(), false, nil
+}
+
+func (n *Node) openPartial(push *commands.Push) (*os.File, string, error) {
+	partialpath := n.partialPath(push.Path, push.Size, push.ModifiedAt)
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if push.Offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(partialpath, flags, 0600)
 	if err != nil {
 		return nil, "", err
 	}
-	return progresswriter.New(file, size, n.Progress), file.Name(), nil
+
+	if push.Offset > 0 {
+		info, err := file.Stat()
+		if err == nil && info.Size() < push.Offset {
+			err = fmt.Errorf("can't resume %v: partial file is only %v bytes", push.Path, info.Size())
+		}
+		if err == nil {
+			err = file.Truncate(push.Offset)
+		}
+		if err == nil {
+			_, err = file.Seek(push.Offset, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			return nil, "", err
+		}
+
+		log.Printf("Resuming %v at %v%%", push.Path, push.Offset*100/push.Size)
+	}
+
+	return file, partialpath, nil
 }
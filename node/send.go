@@ -6,10 +6,15 @@ import (
 	"io/fs"
 	"os"
 	"runtime"
+	"sync/atomic"
 	"unisync/commands"
+	"unisync/log"
+	"unisync/metrics"
 )
 
-func (n *Node) SendFile(path string) error {
+// if partial is set, the other side already has part of the file,
+// and we'll send only the rest of it if it matches what we have
+func (n *Node) SendFile(path string, partial *commands.Partial) error {
 	filename := n.Path(path)
 	info, err := os.Lstat(filename)
 	if err != nil {
@@ -39,10 +44,15 @@ func (n *Node) SendFile(path string) error {
 		mode = 0
 	}
 
+	offset := resumeOffset(filename, info, partial)
+	if offset > 0 {
+		log.Printf("Resuming %v at %v%%", path, offset*100/info.Size())
+	}
+
 	more := true
-	offset := int64(0)
 	for more {
-		len, err := file.ReadAt(n.Buffer, offset)
+		buf := n.Buffer[0:n.sendLimit.ChunkSize(len(n.Buffer))]
+		len, err := file.ReadAt(buf, offset)
 		if err == io.EOF {
 			more = false
 			err = nil
@@ -58,14 +68,19 @@ func (n *Node) SendFile(path string) error {
 			ModifiedAt: info.ModTime().Unix(),
 			Mode:       mode.Perm(),
 			More:       more,
+			Offset:     offset,
 		}
 
+		// wait outside of SendCmdBuf(), so other commands can be sent in the meantime
+		n.sendLimit.Wait(len)
 		err = n.SendCmdBuf(push, n.Buffer[0:len])
 		if err != nil {
 			return err
 		}
 
 		offset += int64(len)
+		atomic.AddInt64(&n.counters.sent, int64(len))
+		metrics.TransferredBytes.With(metrics.Sent).Add(float64(len))
 	}
 
 	return nil
@@ -14,14 +14,38 @@ func (n *Node) Write(p []byte) (int, error) {
 }
 
 func (n *Node) SendCmdBuf(cmd commands.Command, buf []byte) error {
-	err := n.SendString(commands.Encode(cmd))
+	// hold the lock for both, so nothing else gets written in between
+	n.writeLock.Lock()
+	defer n.writeLock.Unlock()
+	return n.sendCmdBuf(cmd, buf)
+}
+
+func (n *Node) SendCmd(cmd commands.Command) error {
+	return n.SendCmdBuf(cmd, nil)
+}
+
+// like SendCmd(), except it gives up (and returns false) instead of waiting
+// for another goroutine to finish writing
+func (n *Node) TrySendCmd(cmd commands.Command) (bool, error) {
+	if !n.writeLock.TryLock() {
+		return false, nil
+	}
+	defer n.writeLock.Unlock()
+	return true, n.sendCmdBuf(cmd, nil)
+}
+
+// writeLock must be held
+func (n *Node) sendCmdBuf(cmd commands.Command, buf []byte) error {
+	str := strings.TrimSpace(commands.Encode(cmd))
+	log.Tracef("-> %v", str)
+	_, err := io.WriteString(n.Out, str+"\n")
 	if err != nil {
 		return err
 	}
 
 	if len(buf) > 0 {
-		log.Debugf("-> [%v bytes]", len(buf))
-		_, err = n.Write(buf)
+		log.Tracef("-> [%v bytes]", len(buf))
+		_, err = n.Out.Write(buf)
 
 		if err != nil {
 			return err
@@ -31,14 +55,10 @@ func (n *Node) SendCmdBuf(cmd commands.Command, buf []byte) error {
 	return nil
 }
 
-func (n *Node) SendCmd(cmd commands.Command) error {
-	return n.SendCmdBuf(cmd, nil)
-}
-
 func (n *Node) SendString(str string) error {
 	str = strings.TrimSpace(str)
 
-	log.Debugf("-> %v", str)
+	log.Tracef("-> %v", str)
 	_, err := io.WriteString(n, str+"\n")
 	if err != nil {
 		return err
@@ -0,0 +1,201 @@
+// Package notifier tells the user about things that need their attention
+// (conflicts, errors, max_delete), by running notify_cmd and/or with a desktop notification,
+// since those otherwise only show up in the log of a background instance.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unisync/client"
+	"unisync/config"
+	"unisync/log"
+	"unisync/shell"
+)
+
+// the same error isn't notified again for this long, so retries don't spam
+var repeatAfter = 10 * time.Minute
+
+// notify_cmd is killed if it takes longer than this
+var cmdTimeout = 30 * time.Second
+
+// Close waits this long for notifications that are still being sent
+var closeTimeout = 5 * time.Second
+
+// at most this many paths are listed in a desktop notification
+var maxDesktopPaths = 5
+
+// what notify_cmd gets on stdin, as json
+type Notification struct {
+	Type    client.EventType `json:"type"`
+	Session string           `json:"session"`
+	Time    time.Time        `json:"time"`
+	Message string           `json:"message"`
+	Paths   []string         `json:"paths,omitempty"`
+	Err     string           `json:"error,omitempty"`
+}
+
+type Notifier struct {
+	Session string
+	Cmd     string
+	Desktop bool
+
+	mutex     sync.Mutex
+	conflicts []string
+	lastErr   string
+	lastErrAt time.Time
+	// notifications being sent, see Close
+	sending sync.WaitGroup
+}
+
+// returns nil if the config doesn't ask for notifications
+func New(conf *config.Config) *Notifier {
+	if conf.NotifyCmd == "" && !conf.NotifyDesktop {
+		return nil
+	}
+	if conf.NotifyDesktop && runtime.GOOS != "linux" {
+		log.Warnln("notify_desktop only works on linux, use notify_cmd instead")
+	}
+
+	return &Notifier{Session: conf.Name, Cmd: conf.NotifyCmd, Desktop: conf.NotifyDesktop}
+}
+
+// Handle takes every event of a session, and notifies the ones that matter
+// it doesn't block, so it can be called from Session.OnEvent
+func (n *Notifier) Handle(event client.Event) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// conflicts come all at once at the start of a sync, send them as one
+	if event.Type == client.EventConflict {
+		n.conflicts = append(n.conflicts, event.Path)
+		return
+	}
+	n.sendConflicts()
+
+	switch event.Type {
+	case client.EventError, client.EventReconnectFailing, client.EventMaxDelete:
+		msg := event.Err.Error()
+		if msg == n.lastErr && time.Since(n.lastErrAt) < repeatAfter {
+			return
+		}
+		n.lastErr = msg
+		n.lastErrAt = time.Now()
+
+		notification := Notification{Type: event.Type, Message: msg, Err: msg}
+		if event.Type == client.EventReconnectFailing {
+			notification.Message = "Still unable to connect: " + msg
+		}
+		n.send(notification)
+
+	case client.EventSynced:
+		// the next error is news, even if it's the same as before
+		n.lastErr = ""
+	}
+}
+
+// Close sends the conflicts that are still held back, and waits a little for
+// what's being sent, since the process usually exits right after
+func (n *Notifier) Close() {
+	n.mutex.Lock()
+	n.sendConflicts()
+	n.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.sending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(closeTimeout):
+		log.Warnln("Gave up waiting for notifications to be sent")
+	}
+}
+
+// mutex must be held
+func (n *Notifier) sendConflicts() {
+	if len(n.conflicts) == 0 {
+		return
+	}
+
+	paths := n.conflicts
+	n.conflicts = nil
+	n.send(Notification{
+		Type:    client.EventConflict,
+		Message: fmt.Sprintf("%v conflicts, kept the preferred version", len(paths)),
+		Paths:   paths,
+	})
+}
+
+// mutex must be held
+func (n *Notifier) send(notification Notification) {
+	notification.Session = n.Session
+	notification.Time = time.Now()
+
+	n.sending.Add(1)
+	// separate goroutine
+	go func() {
+		defer n.sending.Done()
+		if n.Cmd != "" {
+			if err := n.runCmd(notification); err != nil {
+				log.Warnln("notify_cmd failed:", err)
+			}
+		}
+		if n.Desktop && runtime.GOOS == "linux" {
+			if err := desktop(notification); err != nil {
+				log.Warnln("notify-send failed:", err)
+			}
+		}
+	}()
+}
+
+func (n *Notifier) runCmd(notification Notification) error {
+	input, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+	defer cancel()
+
+	cmd := shell.Command(ctx, n.Cmd)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	cmd.Env = append(os.Environ(), "UNISYNC_EVENT="+string(notification.Type), "UNISYNC_SESSION="+n.Session)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func desktop(notification Notification) error {
+	body := notification.Message
+	paths := notification.Paths
+	if len(paths) > maxDesktopPaths {
+		paths = append(paths[:maxDesktopPaths:maxDesktopPaths], "...")
+	}
+	if len(paths) > 0 {
+		body += "\n" + strings.Join(paths, "\n")
+	}
+
+	urgency := "normal"
+	if notification.Type != client.EventConflict {
+		urgency = "critical"
+	}
+
+	title := "unisync " + strings.TrimSuffix(notification.Session, ".conf")
+	output, err := exec.Command("notify-send", "--app-name=unisync", "--urgency="+urgency, title, body).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
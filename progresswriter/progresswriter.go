@@ -12,8 +12,10 @@ type progressWriter struct {
 	closed  bool
 	c       chan Progress
 	start   time.Time
+	offset  int64
 	written int64
 	total   int64
+	limit   func() int64
 	mutex   sync.Mutex
 }
 
@@ -23,17 +25,32 @@ type Progress struct {
 }
 
 func New(w io.WriteCloser, total int64, c chan Progress) *progressWriter {
+	return NewAt(w, 0, total, c)
+}
+
+// like New(), for when the first offset bytes were already written (a resumed transfer)
+func NewAt(w io.WriteCloser, offset, total int64, c chan Progress) *progressWriter {
 	pw := &progressWriter{
-		writer: w,
-		start:  time.Now(),
-		c:      c,
-		total:  total,
+		writer:  w,
+		start:   time.Now(),
+		c:       c,
+		offset:  offset,
+		written: offset,
+		total:   total,
 	}
 
 	pw.startWatch()
 	return pw
 }
 
+// if the sender is rate limited, limit returns the limit in bytes per second (or 0 for none)
+// so the ETA doesn't count on us going faster than that
+func (pw *progressWriter) SetLimit(limit func() int64) {
+	pw.mutex.Lock()
+	defer pw.mutex.Unlock()
+	pw.limit = limit
+}
+
 func (pw *progressWriter) Write(p []byte) (n int, err error) {
 	n, err = pw.writer.Write(p)
 
@@ -71,9 +88,15 @@ func (pw *progressWriter) watch() bool {
 
 	percent := (float64(pw.written) / float64(pw.total)) * 100.0
 	eta := time.Duration(0)
-	if percent > 0 {
-		runtime := time.Since(pw.start)
-		eta = time.Duration(float64(runtime) * ((100.0 - percent) / percent))
+	if done := pw.written - pw.offset; done > 0 {
+		// bytes per second
+		rate := float64(done) / time.Since(pw.start).Seconds()
+		if pw.limit != nil {
+			if limit := float64(pw.limit()); limit > 0 && limit < rate {
+				rate = limit
+			}
+		}
+		eta = time.Duration(float64(pw.total-pw.written) / rate * float64(time.Second))
 	}
 	progress := Progress{int(math.Round(percent)), int(eta.Seconds())}
 
@@ -0,0 +1,87 @@
+// Package ratelimit limits how fast we send, with a token bucket.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// the bucket holds this much time's worth of bytes, so a pause doesn't
+// turn into a burst later
+var burstTime = 100 * time.Millisecond
+
+// the smallest chunk worth sending on its own
+var minChunk = 4096
+
+type Limiter struct {
+	mutex  sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+// rate is in bytes per second, 0 for no limit
+func New(rate int64) *Limiter {
+	return &Limiter{rate: rate, last: time.Now()}
+}
+
+func (l *Limiter) SetRate(rate int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rate = rate
+}
+
+func (l *Limiter) Rate() int64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rate
+}
+
+// ChunkSize is how much to send at a time, at most max
+// while limited, chunks are small, so anything else waiting to be sent
+// doesn't get stuck behind a big one
+func (l *Limiter) ChunkSize(max int) int {
+	rate := l.Rate()
+	if rate <= 0 {
+		return max
+	}
+
+	size := int(float64(rate) * burstTime.Seconds())
+	if size < minChunk {
+		size = minChunk
+	}
+	if size > max {
+		size = max
+	}
+	return size
+}
+
+// Wait blocks until we're allowed to send n bytes
+func (l *Limiter) Wait(n int) {
+	l.mutex.Lock()
+
+	now := time.Now()
+	elapsed := now.Sub(l.last)
+	l.last = now
+
+	if l.rate <= 0 {
+		l.tokens = 0
+		l.mutex.Unlock()
+		return
+	}
+
+	burst := float64(l.rate) * burstTime.Seconds()
+	l.tokens += elapsed.Seconds() * float64(l.rate)
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	time.Sleep(wait)
+}
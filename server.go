@@ -4,22 +4,51 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
+	"unisync/config"
 	"unisync/log"
+	"unisync/metrics"
+	"unisync/node"
 	"unisync/server"
+	"unisync/transports/tlsclient"
 )
 
 func runStdinServer() error {
 	log.ScreenOutput = os.Stderr
 	log.ScreenLevel = log.Warn
 
+	// whoever started us this way can already run commands here
 	s := server.New(os.Stdin, os.Stdout)
+	s.AllowHooks = true
 	return s.Run()
 }
 
-func runDirectServer(addr string) error {
-	cert, capool, err := getCert("secure.key", true)
+// addr can be a [host:]port for TLS, or tcp:[host:]port or unix:/path/to/socket
+// for the unencrypted transports
+func runDirectServer(addr, tokensPath string, allowHooks bool) error {
+	if strings.HasPrefix(addr, "unix:") {
+		return runUnixServer(strings.TrimPrefix(addr, "unix:"), allowHooks)
+	}
+	if strings.HasPrefix(addr, "tcp:") {
+		return runTcpServer(strings.TrimPrefix(addr, "tcp:"), allowHooks)
+	}
+
+	return runTlsServer(addr, tokensPath, allowHooks)
+}
+
+// how long a client gets to finish the TLS handshake
+var handshakeTimeout = 30 * time.Second
+
+func runTlsServer(addr, tokensPath string, allowHooks bool) error {
+	mca, err := tlsclient.LoadKey("secure.key", true)
+	if err != nil {
+		return err
+	}
+	cert, err := mca.GetCert()
 	if err != nil {
 		return err
 	}
@@ -27,7 +56,22 @@ func runDirectServer(addr string) error {
 	conf := &tls.Config{
 		Certificates: cert,
 		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ClientCAs:    capool,
+		ClientCAs:    mca.GetCAPool(),
+	}
+
+	// clients with a token don't have secure.key, so they can't present a certificate
+	var tokens []string
+	if tokensPath != "" {
+		if !filepath.IsAbs(tokensPath) {
+			tokensPath = filepath.Join(config.ConfigDir(), tokensPath)
+		}
+		tokens, err = server.LoadTokens(tokensPath)
+		if err != nil {
+			return fmt.Errorf("Failed to load tokens: %w", err)
+		}
+
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		log.Printf("Accepting %v tokens, clients should use tls_fingerprint = %v", len(tokens), mca.Fingerprint())
 	}
 
 	if !strings.Contains(addr, ":") {
@@ -40,6 +84,68 @@ func runDirectServer(addr string) error {
 		return err
 	}
 
+	return serve(listener, allowHooks, func(conn net.Conn, s *server.Server) error {
+		// a client that connects and then sends nothing would keep its goroutine forever
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := conn.(*tls.Conn).Handshake(); err != nil {
+			return err
+		}
+		conn.SetDeadline(time.Time{})
+
+		if tokens == nil {
+			return nil
+		}
+
+		// a verified certificate is as good as a token
+		if len(conn.(*tls.Conn).ConnectionState().VerifiedChains) == 0 {
+			s.RequireToken(tokens)
+		}
+		return nil
+	})
+}
+
+// no encryption and no authentication, anyone who can reach the port can sync
+func runTcpServer(addr string, allowHooks bool) error {
+	if !strings.Contains(addr, ":") {
+		addr = "127.0.0.1:" + addr
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		log.Warnln("WARNING: listening on a non-loopback address without encryption or authentication")
+	}
+
+	log.Println("listening at", addr, "(unencrypted)")
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return serve(listener, allowHooks, nil)
+}
+
+// the socket's filesystem permissions are the only authentication
+func runUnixServer(path string, allowHooks bool) error {
+	path, err := config.ResolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	listener, err := server.ListenUnix(path)
+	if err != nil {
+		return err
+	}
+	log.Println("listening at", path)
+	defer listener.Close()
+
+	return serve(listener, allowHooks, nil)
+}
+
+// allowHooks is set by -allow-hooks
+func serve(listener net.Listener, allowHooks bool, prepare func(net.Conn, *server.Server) error) error {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -48,8 +154,21 @@ func runDirectServer(addr string) error {
 
 		log.Println("Got connection: ", conn.RemoteAddr())
 		s := server.New(conn, conn)
+		s.AllowHooks = allowHooks
 		go func() {
+			metrics.Connections.Add(1)
+			defer metrics.Connections.Add(-1)
+
+			if prepare != nil {
+				if err := prepare(conn, s); err != nil {
+					conn.Close()
+					log.Warnln("Closed connection:", err)
+					return
+				}
+			}
+
 			if err := s.Run(); err != nil {
+				metrics.Errors.With(node.Classify(err)).Inc()
 				conn.Close()
 				if err == io.EOF {
 					err = fmt.Errorf("client disconnected")
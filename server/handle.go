@@ -3,16 +3,23 @@ package server
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unisync/commands"
 	"unisync/filelist"
+	"unisync/gitignore"
+	"unisync/hooks"
+	"unisync/log"
+	"unisync/metrics"
 	"unisync/node"
 )
 
 func (s *Server) handle(packet *node.Packet) error {
 	cmd := packet.Command
 
-	if cmd.CmdType() != "HELLO" && !s.loggedIn {
+	if cmd.CmdType() != "HELLO" && !s.isLoggedIn() {
 		return fmt.Errorf("must log in with HELLO first")
 	}
 
@@ -21,6 +28,10 @@ func (s *Server) handle(packet *node.Packet) error {
 		return s.handleHELLO(cmd)
 	case "REQLIST":
 		return s.handleREQLIST(cmd)
+	case "REQPARTIAL":
+		return s.handleREQPARTIAL(cmd)
+	case "REQHOOK":
+		return s.handleREQHOOK(cmd)
 	case "MKDIR":
 		return s.handleMKDIR(cmd)
 	case "SYMLINK":
@@ -36,13 +47,15 @@ func (s *Server) handle(packet *node.Packet) error {
 	default:
 		return fmt.Errorf("invalid command")
 	}
-
-	return nil
 }
 
 func (s *Server) handleHELLO(cmd commands.Command) error {
 	hello := cmd.(*commands.Hello)
 
+	if !s.checkToken(hello.Token) {
+		return fmt.Errorf("authentication failed")
+	}
+
 	s.Config = hello.Config
 	err := s.SetBasepath(s.Config.Remote)
 	if err != nil {
@@ -54,26 +67,40 @@ func (s *Server) handleHELLO(cmd commands.Command) error {
 		return fmt.Errorf("Unable to set tmpdir: %w", err)
 	}
 
-	whatsup := &commands.Whatsup{s.GetBasepath()}
-	err = s.SendCmd(whatsup)
-	if err != nil {
-		return err
+	if commands.HasCap(hello.Caps, commands.CapPing) {
+		s.StartHeartbeat(s.Config.Heartbeat)
 	}
+	s.SetBwlimit(int64(s.Config.BwlimitDown)*1024, int64(s.Config.BwlimitUp)*1024)
+	s.ResumeTransfers = commands.HasCap(hello.Caps, commands.CapResume) && s.Config.PartialExpire > 0
+	s.sendOutput = commands.HasCap(hello.Caps, commands.CapOutput)
 
-	s.loggedIn = true
-	return nil
+	// before WHATSUP, the client starts its heartbeat as soon as it gets it
+	atomic.StoreInt32(&s.loggedIn, 1)
+
+	whatsup := &commands.Whatsup{Basepath: s.GetBasepath(), Caps: commands.Caps}
+	return s.SendCmd(whatsup)
 }
 
 func (s *Server) handleREQLIST(cmd commands.Command) error {
 	s.Watcher.Ready()
 
 	reqlist := cmd.(*commands.ReqList)
+	start := time.Now()
 	list, err := filelist.Make(s.Path(reqlist.Path), s.Config.Ignore, s.Config.Symlinks)
 	if err != nil {
 		return err
 	}
 
-	reply := &commands.ResList{list}
+	// other clients might be syncing into the same folder right now
+	if reqlist.Path == "" && !s.cleanedTmp {
+		s.CleanTmpFiles(list, time.Hour)
+		s.cleanedTmp = true
+	}
+
+	reply := &commands.ResList{FileList: list, ScanTime: time.Since(start)}
+	metrics.LastSync.SetToCurrentTime()
+	metrics.Files.Set(float64(len(list)))
+	metrics.ScanDuration.Set(reply.ScanTime.Seconds())
 	return s.SendCmd(reply)
 }
 
@@ -138,8 +165,13 @@ func (s *Server) handlePULL(cmd commands.Command) error {
 		return fmt.Errorf("PULL command must specify at least 1 path")
 	}
 
+	partials := map[string]*commands.Partial{}
+	for i := range pull.Partials {
+		partials[pull.Partials[i].Path] = &pull.Partials[i]
+	}
+
 	for _, path := range pull.Paths {
-		err := s.SendFile(path)
+		err := s.SendFile(path, partials[path])
 		if err != nil {
 			return err
 		}
@@ -148,6 +180,69 @@ func (s *Server) handlePULL(cmd commands.Command) error {
 	return nil
 }
 
+func (s *Server) handleREQPARTIAL(cmd commands.Command) error {
+	reqpartial := cmd.(*commands.ReqPartial)
+	return s.SendCmd(&commands.ResPartial{Partials: s.FindPartials(reqpartial.Files)})
+}
+
+func (s *Server) handleREQHOOK(cmd commands.Command) error {
+	reqhook := cmd.(*commands.ReqHook)
+
+	errs := []string{}
+	for _, err := range s.runHooks(reqhook.Paths) {
+		log.Warnln(err)
+		errs = append(errs, err.Error())
+	}
+	return s.SendCmd(&commands.ResHook{Err: strings.Join(errs, "\n")})
+}
+
+// hook_post_sync_remote, then every on_change rule that matches one of the paths
+// a failed command doesn't stop the next ones
+func (s *Server) runHooks(paths []string) []error {
+	if s.Config.HookPostSyncRemote == "" && len(s.Config.OnChange) == 0 {
+		return nil
+	}
+	if !s.AllowHooks {
+		return []error{fmt.Errorf("hook_post_sync_remote/on_change: the server only runs hooks when started with -allow-hooks")}
+	}
+
+	errs := []error{}
+	if s.Config.HookPostSyncRemote != "" {
+		if err := hooks.Run("hook_post_sync_remote", s.Config.HookPostSyncRemote, s.GetBasepath(), paths, s.outputTo("hook_post_sync_remote")); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, rule := range s.Config.OnChange {
+		matched := []string{}
+		for _, path := range paths {
+			if gitignore.Match(rule.Pattern, path, false) {
+				matched = append(matched, path)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		name := "on_change " + rule.Pattern
+		if err := hooks.Run(name, rule.Command, s.GetBasepath(), matched, s.outputTo(name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// sends each line to the client, for its log
+func (s *Server) outputTo(name string) func(line string) {
+	if !s.sendOutput {
+		return nil
+	}
+	return func(line string) {
+		log.Debugf("[%v] %v", name, line)
+		s.SendCmd(&commands.Output{Name: name, Line: line})
+	}
+}
+
 func (s *Server) handlePUSH(cmd commands.Command, waiter *sync.WaitGroup) error {
 	push := cmd.(*commands.Push)
 	return s.ReceiveFile(push, waiter)
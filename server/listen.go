@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ListenUnix listens on a unix socket at path that only this user can connect to
+// it's made in a private folder and linked into place once its permissions are set,
+// so no one else can connect in between, and nothing already at path gets replaced
+func ListenUnix(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	if runtime.GOOS == "windows" {
+		// no unix permissions there, the socket gets the ACL of its folder
+		return net.Listen("unix", path)
+	}
+
+	// keep the name short, socket paths are limited to about 100 bytes
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dir)
+
+	tmpPath := filepath.Join(dir, "s")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// it would remove tmpPath, which is gone by then
+	listener.SetUnlinkOnClose(false)
+
+	// unlike a rename, a link fails if something took path in the meantime
+	err = os.Chmod(tmpPath, 0600)
+	if err == nil {
+		err = os.Link(tmpPath, path)
+	}
+	os.Remove(tmpPath)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &unixListener{UnixListener: listener, path: path}, nil
+}
+
+// a socket that no one answers on was left behind by a process that's gone
+// one that someone answers on, or anything that isn't a socket, is left alone
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%v already exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, 5*time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%v is in use by another instance", path)
+	}
+	return os.Remove(path)
+}
+
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	os.Remove(l.path)
+	return l.UnixListener.Close()
+}
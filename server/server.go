@@ -3,23 +3,40 @@ package server
 import (
 	"fmt"
 	"io"
+	"sync/atomic"
 	"unisync/commands"
 	"unisync/node"
 )
 
 type Server struct {
-	loggedIn bool
+	// set once HELLO went through, read by sideChannelReader too, see isLoggedIn()
+	loggedIn int32
 	*node.Node
+
+	// if set, HELLO must include a token matching one of these hashes
+	tokens []string
+
+	// run hook_post_sync_remote and on_change when the client asks
+	// off by default, since it lets anyone who can connect run commands
+	AllowHooks bool
+
+	// the client logs the output of on_change commands, see commands.Output
+	sendOutput bool
+
+	// stale temp files are cleaned up once, after the first full list
+	cleanedTmp bool
 }
 
 func New(in io.Reader, out io.Writer) *Server {
 	node := node.New(in, out)
 	node.IsServer = true
+	node.SetSideC("PING", "PONG", "BWLIMIT")
 	return &Server{Node: node}
 }
 
 func (s *Server) Run() error {
 	go s.monitorProgress()
+	go s.sideChannelReader()
 
 	defer s.Watcher.Stop()
 
@@ -61,11 +78,40 @@ func (s *Server) handleWatch() error {
 	return s.SendCmd(&commands.FsEvent{})
 }
 
+// separate goroutine
+func (s *Server) sideChannelReader() {
+	for packet := range s.SideC {
+		// otherwise a client that hasn't logged in could keep the connection alive, or change our bwlimit
+		if !s.isLoggedIn() {
+			s.SetDone(fmt.Errorf("must log in with HELLO first"))
+			continue
+		}
+
+		switch cmdType := packet.Command.CmdType(); cmdType {
+		case "PING", "PONG":
+			if err := s.HandleHeartbeat(packet.Command); err != nil {
+				s.SetDone(err)
+			}
+
+		case "BWLIMIT":
+			bwlimit := packet.Command.(*commands.Bwlimit)
+			s.SetBwlimit(int64(bwlimit.Down)*1024, int64(bwlimit.Up)*1024)
+
+		default:
+			panic("invalid packet in SideC: " + cmdType)
+		}
+	}
+}
+
+func (s *Server) isLoggedIn() bool {
+	return atomic.LoadInt32(&s.loggedIn) == 1
+}
+
 // separate goroutine
 func (s *Server) monitorProgress() {
 	var err error
 	for progress := range s.Progress {
-		err = s.SendCmd(&commands.Progress{progress.Percent, progress.Eta})
+		err = s.SendCmd(&commands.Progress{Percent: progress.Percent, Eta: progress.Eta})
 		if err != nil {
 			break
 		}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tokens are never stored in plaintext on the server, only their sha256 hashes
+func HashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+// one hash per line, anything after a # is a comment
+func LoadTokens(fullpath string) ([]string, error) {
+	file, err := os.Open(fullpath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" {
+			continue
+		}
+		if len(line) != sha256.Size*2 {
+			return nil, fmt.Errorf("%v <-- not a token hash (use -hashtoken to make one)", line)
+		}
+
+		hashes = append(hashes, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("%v has no tokens in it", fullpath)
+	}
+	return hashes, nil
+}
+
+func (s *Server) RequireToken(hashes []string) {
+	s.tokens = hashes
+}
+
+func (s *Server) checkToken(token string) bool {
+	if s.tokens == nil {
+		return true
+	}
+	if token == "" {
+		return false
+	}
+
+	hash := []byte(HashToken(token))
+	valid := false
+	for _, allowed := range s.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(allowed)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
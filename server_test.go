@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unisync/config"
+	"unisync/session"
+)
+
+// a client with method=unix syncing both ways through -server unix:...
+func TestUnixServer(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local")
+	remote := filepath.Join(dir, "remote")
+	socket := filepath.Join(dir, "s.sock")
+
+	write := func(path, data string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(local, "a.txt"), "from local")
+	write(filepath.Join(local, "sub", "b.txt"), "also from local")
+	write(filepath.Join(remote, "c.txt"), "from remote")
+	// for the cache
+	if err := os.Mkdir(filepath.Join(dir, "conf"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("UNISYNC_DIR", filepath.Join(dir, "conf"))
+
+	go runUnixServer(socket, false)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("server didn't start")
+		}
+	}
+
+	conf, err := config.Parse("", "local="+local, "remote="+remote, "method=unix", "socket="+socket,
+		"watch_local=0", "watch_remote=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := session.New(conf).Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(remote, "a.txt"):        "from local",
+		filepath.Join(remote, "sub", "b.txt"): "also from local",
+		filepath.Join(local, "c.txt"):         "from remote",
+	} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != want {
+			t.Errorf("%v: got %q, want %q", path, got, want)
+		}
+	}
+}
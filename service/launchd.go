@@ -0,0 +1,120 @@
+//go:build darwin
+// +build darwin
+
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unisync/config"
+	"unisync/log"
+)
+
+// restart if it exits with an error, but not if it was told to stop
+var plistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%v</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%v</string>
+		<string>%v</string>
+	</array>
+	<key>EnvironmentVariables</key>
+	<dict>
+%v	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>10</integer>
+	<key>ProcessType</key>
+	<string>Background</string>
+</dict>
+</plist>
+`
+
+func label(name string) string {
+	return "sh.unisync." + name
+}
+
+func plistPath(name string) string {
+	return filepath.Join(config.HomeDir(), "Library", "LaunchAgents", label(name)+".plist")
+}
+
+func install(name, exe, confPath string) error {
+	path := plistPath(name)
+
+	env := environment()
+	keys := []string{}
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	environment := ""
+	for _, key := range keys {
+		environment += fmt.Sprintf("\t\t<key>%v</key>\n\t\t<string>%v</string>\n", escape(key), escape(env[key]))
+	}
+
+	plist := fmt.Sprintf(plistTemplate, escape(label(name)), escape(exe), escape(confPath), environment)
+	if err := writeFile(path, []byte(plist)); err != nil {
+		return fmt.Errorf("Unable to write %v: %w", path, err)
+	}
+	log.Println("Wrote", path)
+
+	if err := launchctl("load", "-w", path); err != nil {
+		return err
+	}
+
+	log.Printf("Installed. Check on it with: launchctl list %v", label(name))
+	return nil
+}
+
+// launchd sets this to the job's label
+func startedByService() bool {
+	return strings.HasPrefix(os.Getenv("XPC_SERVICE_NAME"), label(""))
+}
+
+func uninstall(name string) error {
+	path := plistPath(name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%v is not installed as a service", name)
+	}
+
+	if err := launchctl("unload", "-w", path); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	log.Println("Removed", path)
+	return nil
+}
+
+func launchctl(args ...string) error {
+	output, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %v: %v %v", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func escape(str string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(str))
+	return buf.String()
+}
@@ -0,0 +1,77 @@
+// Package service installs unisync as a user service that starts on login,
+// using systemd on linux and launchd on macOS, and lets the client report
+// its state to systemd with sd_notify.
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Install sets up the config at confPath to run as a service, and starts it
+// name is the config's name, like "myserver.conf"
+func Install(name, confPath string) error {
+	exe, err := executable()
+	if err != nil {
+		return err
+	}
+
+	return install(serviceName(name), exe, confPath)
+}
+
+// IsService tells whether we were started by the service Install made, rather than from a terminal
+func IsService() bool {
+	return startedByService()
+}
+
+// Uninstall stops the service and removes it
+func Uninstall(name string) error {
+	return uninstall(serviceName(name))
+}
+
+// "myserver.conf" -> "myserver", with anything a unit or label can't hold replaced
+func serviceName(name string) string {
+	name = strings.TrimSuffix(name, ".conf")
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("Unable to find the unisync executable: %w", err)
+	}
+
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return "", fmt.Errorf("Unable to find the unisync executable: %w", err)
+	}
+
+	return exe, nil
+}
+
+// the service won't inherit our environment, so pass on the one variable that matters
+func environment() map[string]string {
+	env := map[string]string{}
+	if dir := os.Getenv("UNISYNC_DIR"); dir != "" {
+		env["UNISYNC_DIR"] = dir
+	}
+	return env
+}
+
+func writeFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,120 @@
+//go:build linux
+// +build linux
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unisync/log"
+)
+
+// the client tells systemd when it's done the first sync (Type=notify),
+// and pings the watchdog while it's running
+// long transfers ping too, so WatchdogSec only needs to cover a hung connection
+var unitTemplate = `[Unit]
+Description=unisync %v
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart=%v
+%vRestart=on-failure
+RestartSec=10
+TimeoutStartSec=infinity
+TimeoutStopSec=30
+WatchdogSec=300
+
+[Install]
+WantedBy=default.target
+`
+
+func unitPath(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "systemd", "user", "unisync-"+name+".service"), nil
+}
+
+func install(name, exe, confPath string) error {
+	path, err := unitPath(name)
+	if err != nil {
+		return err
+	}
+
+	env := environment()
+	keys := []string{}
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	environment := ""
+	for _, key := range keys {
+		environment += fmt.Sprintf("Environment=%v\n", systemdQuote(key+"="+env[key]))
+	}
+
+	unit := fmt.Sprintf(unitTemplate, name, systemdQuote(exe)+" "+systemdQuote(confPath), environment)
+	if err = writeFile(path, []byte(unit)); err != nil {
+		return fmt.Errorf("Unable to write %v: %w", path, err)
+	}
+	log.Println("Wrote", path)
+
+	if err = systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err = systemctl("enable", "--now", filepath.Base(path)); err != nil {
+		return err
+	}
+
+	log.Printf("Installed. Check on it with: systemctl --user status %v", filepath.Base(path))
+	return nil
+}
+
+// systemd only sets this for Type=notify units, which is what install makes
+func startedByService() bool {
+	return os.Getenv("NOTIFY_SOCKET") != ""
+}
+
+func uninstall(name string) error {
+	path, err := unitPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(path); err != nil {
+		return fmt.Errorf("%v is not installed as a service", name)
+	}
+
+	if err = systemctl("disable", "--now", filepath.Base(path)); err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil {
+		return err
+	}
+	log.Println("Removed", path)
+
+	return systemctl("daemon-reload")
+}
+
+func systemctl(args ...string) error {
+	args = append([]string{"--user"}, args...)
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %v: %v %v", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// systemd unescapes quotes and backslashes, and expands % specifiers
+func systemdQuote(str string) string {
+	str = strings.ReplaceAll(str, `\`, `\\`)
+	str = strings.ReplaceAll(str, `"`, `\"`)
+	str = strings.ReplaceAll(str, `%`, `%%`)
+	return `"` + str + `"`
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package service
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func install(name, exe, confPath string) error {
+	return fmt.Errorf("installing a service is not supported on %v", runtime.GOOS)
+}
+
+func uninstall(name string) error {
+	return fmt.Errorf("installing a service is not supported on %v", runtime.GOOS)
+}
+
+func startedByService() bool {
+	return false
+}
@@ -0,0 +1,46 @@
+package session
+
+import (
+	"math/rand"
+	"time"
+	"unisync/node"
+)
+
+var errResumed = node.NewNetworkError("resumed from sleep")
+var errNetworkChanged = node.NewNetworkError("network changed")
+
+// exponential backoff with jitter, so a server that comes back up
+// isn't hit by every client at the same moment
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+	rand    *rand.Rand
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{
+		min:  min,
+		max:  max,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (b *backoff) next() time.Duration {
+	delay := b.max
+	if b.attempt < 32 && b.min<<b.attempt < b.max {
+		delay = b.min << b.attempt
+	}
+	b.attempt++
+
+	// somewhere between half and all of it, but never less than min
+	delay = delay/2 + time.Duration(b.rand.Int63n(int64(delay/2)+1))
+	if delay < b.min {
+		delay = b.min
+	}
+	return delay
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,447 @@
+// Package session runs a continuous sync between a local and a remote folder,
+// reconnecting when the connection drops. It's what the unisync command runs,
+// and it can be embedded in other programs:
+//
+//	conf, err := config.Parse("myserver")
+//	s := session.New(conf)
+//	s.OnEvent = func(e session.Event) { fmt.Println(e.Type, e.Path) }
+//	err = s.Start(ctx)
+//	...
+//	err = s.Stop()
+//
+// Log messages go to the unisync/log package, like the rest of unisync's. To send
+// them elsewhere, set log.ScreenOutput (nil for none) and add outputs with log.Add.
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unisync/background"
+	"unisync/client"
+	"unisync/config"
+	"unisync/log"
+	"unisync/metrics"
+	"unisync/node"
+	"unisync/transports"
+
+	// built-in transports register themselves
+	_ "unisync/transports/command"
+	_ "unisync/transports/externalssh"
+	_ "unisync/transports/internalssh"
+	_ "unisync/transports/netclient"
+	_ "unisync/transports/tlsclient"
+)
+
+type Event = client.Event
+type EventType = client.EventType
+
+const (
+	EventPush         = client.EventPush
+	EventPull         = client.EventPull
+	EventDeleteLocal  = client.EventDeleteLocal
+	EventDeleteRemote = client.EventDeleteRemote
+	EventConflict     = client.EventConflict
+	EventSynced       = client.EventSynced
+	EventError        = client.EventError
+
+	EventMaxDelete        = client.EventMaxDelete
+	EventReconnectFailing = client.EventReconnectFailing
+)
+
+// after this many failed attempts in a row, emit EventReconnectFailing
+var reconnectFailingAfter = 3
+
+type Session struct {
+	Config *config.Config
+
+	// if set, called for each file pushed, pulled or deleted, each conflict,
+	// each completed sync, and each error that drops the connection
+	// it runs on the session's goroutine, so it shouldn't block
+	OnEvent func(Event)
+
+	// detach from the terminal after the first sync (see client.Client.Background)
+	Background bool
+
+	// no one is watching (a service, say), so keep retrying even if the first try fails
+	// Background implies it
+	Unattended bool
+
+	// how long to wait before reconnecting, doubling after each failure
+	// in between RetryMin and RetryMax
+	RetryMin time.Duration
+	RetryMax time.Duration
+
+	// give up after this many failed attempts in a row, 0 to keep trying forever
+	MaxRetries int
+
+	// once stopped, how long to let the file being transferred finish
+	// before dropping the connection
+	StopTimeout time.Duration
+
+	// if set, called at least every WatchdogInterval while the session is
+	// working normally (see client.Client.Watchdog)
+	Watchdog         func()
+	WatchdogInterval time.Duration
+
+	mutex   sync.Mutex
+	client  *client.Client
+	cancel  context.CancelFunc
+	running chan struct{}
+	err     error
+
+	// set by SetBwlimit()
+	bwlimit *Bwlimit
+
+	// for Status()
+	state     string
+	paused    bool
+	lastSync  time.Time
+	nextRetry time.Time
+	errors    []StatusError
+	// from earlier connections, see Status.Totals
+	totals client.SyncStats
+	// post sync hooks that haven't run yet, kept across reconnects
+	pendingHooks *client.PendingHooks
+}
+
+func New(conf *config.Config) *Session {
+	return &Session{
+		Config:      conf,
+		RetryMin:    conf.RetryMin,
+		RetryMax:    conf.RetryMax,
+		MaxRetries:  conf.MaxRetries,
+		StopTimeout: 20 * time.Second,
+
+		pendingHooks: &client.PendingHooks{},
+	}
+}
+
+// Start runs the session in its own goroutine until ctx is cancelled or Stop() is called
+// use Wait() to get the error it stopped with
+func (s *Session) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running != nil {
+		return fmt.Errorf("session is already started")
+	}
+
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.running = make(chan struct{})
+
+	go func() {
+		err := s.Run(ctx)
+
+		s.mutex.Lock()
+		s.err = err
+		close(s.running)
+		s.mutex.Unlock()
+	}()
+
+	return nil
+}
+
+func (s *Session) Stop() error {
+	s.mutex.Lock()
+	cancel := s.cancel
+	s.mutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	return s.Wait()
+}
+
+func (s *Session) Wait() error {
+	s.mutex.Lock()
+	running := s.running
+	s.mutex.Unlock()
+
+	if running == nil {
+		return fmt.Errorf("session was never started")
+	}
+
+	<-running
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// SyncNow asks the session to sync right away, instead of waiting for
+// the watcher to notice a change. Does nothing if we're not connected.
+func (s *Session) SyncNow() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.client != nil {
+		s.client.SyncNow()
+	}
+}
+
+// Run is like Start(), except it blocks until the session ends
+// it returns nil when ctx is cancelled, or when there's nothing to watch
+// after the first sync
+func (s *Session) Run(ctx context.Context) error {
+	defer s.setState(StateStopped)
+	defer s.logTotals()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wakeC := make(chan error, 1)
+	go watchWake(ctx, wakeC)
+
+	// if the first try doesn't fully connect and sync, it's probably a problem with
+	// the config, so only retry it when no one is watching (see Unattended)
+	everConnected := false
+	failures := 0
+	backoff := newBackoff(s.RetryMin, s.RetryMax)
+
+	for {
+		connected, err := s.runOnce(ctx, wakeC)
+		if connected {
+			everConnected = true
+			failures = 0
+			backoff.reset()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			return nil
+		}
+
+		reason := node.Classify(err)
+		if connected {
+			log.With(log.Fields{Err: err}).Warnf("Client disconnected (%v): %v", reason, err)
+		} else {
+			log.With(log.Fields{Err: err}).Warnf("Unable to connect (%v): %v", reason, err)
+		}
+		s.addError(err, reason)
+		metrics.Errors.With(reason).Inc()
+		s.emit(Event{Type: EventError, Err: err})
+
+		if !everConnected && (!(s.Background || s.Unattended) || reason == node.ReasonAuth) {
+			return err
+		}
+
+		failures++
+		if failures == reconnectFailingAfter {
+			s.emit(Event{Type: EventReconnectFailing, Err: err})
+		}
+		if s.MaxRetries > 0 && failures > s.MaxRetries {
+			log.Warnf("Giving up after %v retries", s.MaxRetries)
+			return err
+		}
+
+		delay := backoff.next()
+		log.Printf("Retrying in %v..", delay.Round(100*time.Millisecond))
+		s.mutex.Lock()
+		s.state = StateRetrying
+		s.nextRetry = time.Now().Add(delay)
+		s.mutex.Unlock()
+
+		if s.Background && !everConnected && failures == 1 {
+			log.Println("Will keep trying in the background..")
+			background.Detach()
+		}
+
+		if err := s.waitRetry(ctx, delay, wakeC); err != nil {
+			return nil
+		}
+		metrics.Reconnects.Inc()
+	}
+}
+
+// returns an error if ctx is cancelled while waiting
+func (s *Session) waitRetry(ctx context.Context, delay time.Duration, wakeC chan error) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var watchdogC <-chan time.Time
+	if s.Watchdog != nil && s.WatchdogInterval > 0 {
+		s.Watchdog()
+		ticker := time.NewTicker(s.WatchdogInterval)
+		defer ticker.Stop()
+		watchdogC = ticker.C
+	}
+
+	for {
+		select {
+		case <-timer.C:
+			return nil
+		case reason := <-wakeC:
+			log.Printf("Retrying now, %v..", reason)
+			return nil
+		case <-watchdogC:
+			s.Watchdog()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Session) runOnce(ctx context.Context, wakeC chan error) (bool, error) {
+	conf := s.connConfig()
+	s.setState(StateConnecting)
+	log.Printf("Connecting to %v (%v)", transports.Target(conf), conf.Method)
+
+	t, err := transports.New(conf)
+	if err != nil {
+		return false, err
+	}
+	var closeOnce sync.Once
+	closeTransport := func() {
+		closeOnce.Do(func() {
+			err := t.Close()
+			if err != nil {
+				log.Warnln(conf.Method, "exited:", err)
+			}
+		})
+	}
+	defer closeTransport()
+
+	out, in, err := t.Run()
+	if err != nil {
+		return false, err
+	}
+	metrics.Connections.Add(1)
+	defer metrics.Connections.Add(-1)
+
+	c, err := client.New(in, out, conf)
+	if err != nil {
+		return false, err
+	}
+	c.Background = s.Background
+	c.OnEvent = s.handleEvent
+	c.Watchdog = s.Watchdog
+	c.WatchdogInterval = s.WatchdogInterval
+	c.PendingHooks = s.pendingHooks
+
+	s.setClient(c)
+	defer s.setClient(nil)
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go s.monitor(ctx, c, closeTransport, wakeC, finished)
+
+	return c.Run(ctx)
+}
+
+// separate goroutine
+func (s *Session) monitor(ctx context.Context, c *client.Client, closeTransport func(), wakeC chan error, finished chan struct{}) {
+	doneC := c.DoneC()
+
+	for {
+		select {
+		case <-doneC:
+			// c.Run() might be stuck reading from a connection that's dead (see Node.StartHeartbeat)
+			closeTransport()
+			return
+
+		case <-ctx.Done():
+			// c.Run() will exit on its own once the current transfer is done
+			// if it takes too long, drop the connection to force it
+			select {
+			case <-time.After(s.StopTimeout):
+				log.Warnln("Timed out waiting for sync to finish, disconnecting..")
+				c.SetDone(ctx.Err())
+				closeTransport()
+			case <-finished:
+			}
+			return
+
+		case reason := <-wakeC:
+			// the connection is probably dead after a sleep, and we'd otherwise
+			// wait for it to time out. a new network might just be a new vpn
+			if reason == errResumed {
+				c.SetDone(reason)
+				closeTransport()
+				return
+			}
+
+		case <-finished:
+			return
+		}
+	}
+}
+
+// the config for the next connection, with any overrides
+func (s *Session) connConfig() *config.Config {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	conf := *s.Config
+	if s.bwlimit != nil {
+		conf.BwlimitUp = s.bwlimit.Up
+		conf.BwlimitDown = s.bwlimit.Down
+	}
+	return &conf
+}
+
+// SetBwlimit overrides bwlimit_up and bwlimit_down (in KB/s, 0 for no limit)
+// for the rest of the session, starting right away
+func (s *Session) SetBwlimit(up, down int) {
+	s.mutex.Lock()
+	s.bwlimit = &Bwlimit{Up: up, Down: down}
+	log.Printf("Limiting transfers to %v", s.bwlimit)
+	c := s.client
+	s.mutex.Unlock()
+
+	if c != nil {
+		if err := c.SetBwlimit(up, down); err != nil {
+			log.Warnln(err)
+		}
+	}
+}
+
+func formatBwlimit(limit int) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%v KB/s", limit)
+}
+
+func (s *Session) setClient(c *client.Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if c != nil && s.paused {
+		c.Pause()
+	}
+	if s.client != nil {
+		s.totals.Add(s.client.Status().Totals)
+	}
+	s.client = c
+}
+
+func (s *Session) logTotals() {
+	totals := s.Status().Totals
+	if totals.Syncs > 0 {
+		log.Printf("Totals for %v syncs: %v", totals.Syncs, totals)
+	}
+}
+
+func (s *Session) handleEvent(event Event) {
+	switch event.Type {
+	case EventSynced:
+		s.mutex.Lock()
+		s.lastSync = time.Now()
+		s.mutex.Unlock()
+
+	case EventMaxDelete:
+		// the client paused itself, Resume() lets it go ahead
+		s.mutex.Lock()
+		s.paused = true
+		s.mutex.Unlock()
+	}
+
+	s.emit(event)
+}
+
+func (s *Session) emit(event Event) {
+	if s.OnEvent != nil {
+		s.OnEvent(event)
+	}
+}
@@ -0,0 +1,146 @@
+package session
+
+import (
+	"fmt"
+	"time"
+	"unisync/client"
+	"unisync/log"
+	"unisync/transports"
+)
+
+// how many errors Status() remembers
+var maxStatusErrors = 10
+
+type Status struct {
+	Name      string           `json:"name"`
+	State     string           `json:"state"`
+	Method    string           `json:"method"`
+	Target    string           `json:"target"`
+	Local     string           `json:"local"`
+	Remote    string           `json:"remote"`
+	Paused    bool             `json:"paused"`
+	LastSync  time.Time        `json:"last_sync"`
+	NextRetry time.Time        `json:"next_retry"`
+	Queued    int              `json:"queued"`
+	Latency   time.Duration    `json:"latency"`
+	Bwlimit   Bwlimit          `json:"bwlimit"`
+	Transfer  *client.Transfer `json:"transfer,omitempty"`
+	Errors    []StatusError    `json:"errors,omitempty"`
+	// everything synced since the session started
+	Totals client.SyncStats `json:"totals"`
+}
+
+// in KB/s, 0 for no limit
+type Bwlimit struct {
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+func (b Bwlimit) String() string {
+	return fmt.Sprintf("%v up, %v down", formatBwlimit(b.Up), formatBwlimit(b.Down))
+}
+
+type StatusError struct {
+	Time time.Time `json:"time"`
+	Err  string    `json:"err"`
+	// one of the node.Reason constants
+	Reason string `json:"reason"`
+}
+
+const (
+	StateConnecting = "connecting"
+	StateSyncing    = "syncing"
+	StateWatching   = "watching"
+	StatePaused     = "paused"
+	StateRetrying   = "retrying"
+	StateStopped    = "stopped"
+)
+
+func (s *Session) Status() *Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := &Status{
+		Name:      s.Config.Name,
+		State:     s.state,
+		Method:    s.Config.Method,
+		Target:    transports.Target(s.Config),
+		Local:     s.Config.Local,
+		Remote:    s.Config.Remote,
+		Paused:    s.paused,
+		LastSync:  s.lastSync,
+		NextRetry: s.nextRetry,
+		Errors:    append([]StatusError{}, s.errors...),
+		Bwlimit:   Bwlimit{Up: s.Config.BwlimitUp, Down: s.Config.BwlimitDown},
+		Totals:    s.totals,
+	}
+	if s.bwlimit != nil {
+		status.Bwlimit = *s.bwlimit
+	}
+
+	if s.client != nil {
+		cs := s.client.Status()
+		status.Queued = cs.Queued
+		status.Transfer = cs.Transfer
+		status.Latency = cs.Latency
+		status.Totals.Add(cs.Totals)
+
+		if cs.Syncing {
+			status.State = StateSyncing
+		} else if cs.Paused {
+			status.State = StatePaused
+		} else {
+			status.State = StateWatching
+		}
+	}
+
+	return status
+}
+
+func (s *Session) setState(state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state = state
+}
+
+func (s *Session) addError(err error, reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.errors = append(s.errors, StatusError{Time: time.Now(), Err: err.Error(), Reason: reason})
+	if len(s.errors) > maxStatusErrors {
+		s.errors = s.errors[len(s.errors)-maxStatusErrors:]
+	}
+}
+
+// Pause stops syncing until Resume() is called, but stays connected and
+// keeps track of changes, so we can sync them all at once
+func (s *Session) Pause() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.paused {
+		return
+	}
+
+	log.Printf("%v %v", "[X]", "Paused. Will sync when resumed..")
+	s.paused = true
+	if s.client != nil {
+		s.client.Pause()
+	}
+}
+
+func (s *Session) Resume() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.paused {
+		return
+	}
+
+	log.Printf("%v %v", "[X]", "Resumed.")
+	s.paused = false
+	if s.client != nil {
+		s.client.Resume()
+	}
+}
@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// how often to check if we've been asleep, or the network changed
+var wakeCheckFreq = 2 * time.Second
+
+// a check that's this much later than it should be means we were asleep
+var sleepThreshold = 10 * time.Second
+
+// separate goroutine
+// sends errResumed or errNetworkChanged on c, whenever it's a good time to reconnect right away
+func watchWake(ctx context.Context, c chan<- error) {
+	ticker := time.NewTicker(wakeCheckFreq)
+	defer ticker.Stop()
+
+	// Round(0) drops the monotonic clock, which stops while we're asleep
+	last := time.Now().Round(0)
+	addrs := interfaceAddrs()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var reason error
+		now := time.Now().Round(0)
+		if now.Sub(last) > wakeCheckFreq+sleepThreshold {
+			reason = errResumed
+		}
+		last = now
+
+		if newAddrs := interfaceAddrs(); newAddrs != addrs {
+			addrs = newAddrs
+			if reason == nil {
+				reason = errNetworkChanged
+			}
+		}
+
+		if reason != nil {
+			select {
+			case c <- reason:
+			default:
+			}
+		}
+	}
+}
+
+func interfaceAddrs() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+
+	strs := []string{}
+	for _, addr := range addrs {
+		strs = append(strs, addr.String())
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, " ")
+}
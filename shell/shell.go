@@ -0,0 +1,16 @@
+// Package shell runs the commands given in the config, like notify_cmd and the hooks,
+// with sh on unix and cmd on windows, so pipes and && work as expected
+package shell
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+)
+
+func Command(ctx context.Context, str string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", str)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", str)
+}
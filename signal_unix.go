@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unisync/background"
+	"unisync/config"
+	"unisync/log"
+	"unisync/service"
+	"unisync/session"
+)
+
+// kill -USR1 pauses syncing, kill -USR2 resumes it
+func handlePauseSignals(s *session.Session) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range c {
+			if sig == syscall.SIGUSR1 {
+				s.Pause()
+			} else {
+				s.Resume()
+			}
+		}
+	}()
+}
+
+// kill -HUP reopens the log file, so logrotate can move it away
+// only in the background, in a terminal SIGHUP should still stop us when the terminal closes
+func reopenLogOnSignal(conf *config.Config) {
+	if conf.Log == "" || !(background.IsChild() || service.IsService()) {
+		return
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	go func() {
+		for range c {
+			if err := log.Reopen(); err != nil {
+				log.Warnln("Unable to reopen log:", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"unisync/config"
+	"unisync/session"
+)
+
+// windows has no SIGUSR1/SIGUSR2, so use -pause and -resume instead
+func handlePauseSignals(s *session.Session) {}
+
+// there's no SIGHUP either, log files rotate themselves anyway (see log_max_size)
+func reopenLogOnSignal(conf *config.Config) {}
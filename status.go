@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unisync/background"
+	"unisync/config"
+	"unisync/control"
+	"unisync/node"
+	"unisync/session"
+)
+
+func showRunning() {
+	running := background.ListRunning()
+
+	if len(running) == 0 {
+		fmt.Println("There are no background instances running.")
+		return
+	}
+
+	fmt.Println("Background instances running:")
+	for _, name := range running {
+		status := &session.Status{}
+		err := control.Send(name, &control.Request{Cmd: "status"}, status)
+		if err != nil {
+			fmt.Println(name)
+		} else {
+			fmt.Printf("%v (%v)\n", name, status.State)
+		}
+	}
+}
+
+func showStatus(arg string) error {
+	name := config.NameOf(arg)
+	status := &session.Status{}
+	err := control.Send(name, &control.Request{Cmd: "status"}, status)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v: %v\n", name, status.State)
+	fmt.Printf("  remote: %v (%v)\n", status.Target, status.Method)
+	if status.Latency > 0 {
+		fmt.Printf("  latency: %v\n", node.RoundLatency(status.Latency))
+	}
+	fmt.Printf("  syncing: %v <-> %v\n", status.Local, status.Remote)
+	if status.LastSync.IsZero() {
+		fmt.Println("  last sync: never")
+	} else {
+		fmt.Printf("  last sync: %v (%v ago)\n", status.LastSync.Format("2006-01-02 15:04:05"), ago(status.LastSync))
+	}
+	if status.Totals.Syncs > 0 {
+		fmt.Printf("  totals: %v syncs, %v\n", status.Totals.Syncs, status.Totals)
+	}
+	if status.State == session.StateRetrying {
+		fmt.Printf("  next retry: in %v\n", time.Until(status.NextRetry).Round(time.Second))
+	}
+	if b := status.Bwlimit; b.Up > 0 || b.Down > 0 {
+		fmt.Printf("  bwlimit: %v\n", b)
+	}
+	if status.Paused {
+		fmt.Printf("  paused: %v changes will sync when resumed\n", status.Queued)
+	} else {
+		fmt.Printf("  queued changes: %v\n", status.Queued)
+	}
+
+	if t := status.Transfer; t != nil {
+		fmt.Printf("  transfer: %v %v %v%% ETA: %v\n", t.Direction, t.Path, t.Percent, time.Duration(t.Eta)*time.Second)
+	}
+
+	if len(status.Errors) > 0 {
+		fmt.Println("  recent errors:")
+		for _, e := range status.Errors {
+			fmt.Printf("    %v (%v) %v\n", e.Time.Format("2006-01-02 15:04:05"), e.Reason, e.Err)
+		}
+	}
+
+	return nil
+}
+
+func sendControl(arg, cmd string) error {
+	return control.Send(config.NameOf(arg), &control.Request{Cmd: cmd}, nil)
+}
+
+func sendBwlimit(arg, bwlimit string) error {
+	// catch mistakes here, instead of in the log of the running instance
+	if _, _, err := parseBwlimit(bwlimit); err != nil {
+		return err
+	}
+	return control.Send(config.NameOf(arg), &control.Request{Cmd: "bwlimit", Arg: bwlimit}, nil)
+}
+
+func ago(t time.Time) time.Duration {
+	return time.Since(t).Round(time.Second)
+}
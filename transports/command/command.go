@@ -0,0 +1,96 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"unisync/config"
+	"unisync/transports"
+)
+
+func init() {
+	transports.Register("exec", &transports.Method{
+		New: func(conf *config.Config) (transports.Transport, error) {
+			return New(conf)
+		},
+		Validate: func(c *config.Config) error {
+			if c.Command == "" {
+				return config.SettingMissing("command")
+			}
+			return nil
+		},
+		Target: func(c *config.Config) string {
+			return c.Command
+		},
+	})
+}
+
+// runs an arbitrary command (docker exec, kubectl exec, ..) that starts
+// unisync -stdserver on the other side, and talks to it through stdin/stdout
+type commandClient struct {
+	transports.Exec
+	args []string
+}
+
+func New(conf *config.Config) (*commandClient, error) {
+	// unlike ssh, there's no shell on the other side that we could use to search
+	// remote_unisync_path, so just take the first one (help.go says so too)
+	str := strings.ReplaceAll(conf.Command, "{remote_unisync}", conf.RemoteUnisyncPath[0])
+
+	args, err := splitArgs(str)
+	if err != nil {
+		return nil, fmt.Errorf("command=%v <-- %w", conf.Command, err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("command is empty")
+	}
+
+	return &commandClient{args: args}, nil
+}
+
+func (c *commandClient) Run() (stdin io.Writer, stdout io.Reader, err error) {
+	stdin, stdout, err = c.Start(exec.Command(c.args[0], c.args[1:]...))
+	if err != nil {
+		err = fmt.Errorf("command error: %w", err)
+	}
+	return
+}
+
+// splits on spaces, except inside single or double quotes
+// needed for things like: gcloud compute ssh myvm --command "unisync -stdserver"
+func splitArgs(str string) ([]string, error) {
+	args := []string{}
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range str {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,69 @@
+package transports
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"strings"
+	"unisync/log"
+)
+
+// for transports that run a command which starts unisync -stdserver on the other side
+// (ssh, exec), embed it for Close()
+type Exec struct {
+	execCmd *exec.Cmd
+}
+
+// Start runs execCmd and returns its stdin and stdout, logging its stderr as it comes
+func (e *Exec) Start(execCmd *exec.Cmd) (stdin io.Writer, stdout io.Reader, err error) {
+	e.execCmd = execCmd
+
+	var stderr io.Reader
+	if stdin, err = e.execCmd.StdinPipe(); err != nil {
+		return
+	}
+	if stdout, err = e.execCmd.StdoutPipe(); err != nil {
+		return
+	}
+	if stderr, err = e.execCmd.StderrPipe(); err != nil {
+		return
+	}
+
+	err = e.execCmd.Start()
+	if err != nil {
+		return
+	}
+
+	go logerr(stderr)
+	return
+}
+
+func (e *Exec) Close() error {
+	if e.execCmd == nil {
+		return nil
+	}
+	if e.execCmd.Process != nil {
+		err := e.execCmd.Process.Kill()
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.execCmd.Wait()
+}
+
+// separate goroutine
+func logerr(stderr io.Reader) {
+	reader := bufio.NewReader(stderr)
+	var err error
+
+	for err == nil {
+		var line string
+		line, err = reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+
+		if line != "" {
+			log.Warnln("Server Says:", line)
+		}
+	}
+}
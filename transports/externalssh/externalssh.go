@@ -1,19 +1,35 @@
 package externalssh
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"os/exec"
 	"strings"
 	"unisync/config"
-	"unisync/log"
+	"unisync/transports"
 )
 
+func init() {
+	transports.Register("ssh", &transports.Method{
+		New: func(conf *config.Config) (transports.Transport, error) {
+			return New(conf), nil
+		},
+		Validate: validate,
+		Target:   transports.SshTarget,
+	})
+}
+
+func validate(c *config.Config) error {
+	if !strings.Contains(c.SshOpts, "-e none") {
+		return fmt.Errorf(`setting ssh_opts must contain "-e none"`)
+	}
+	return transports.ValidateSsh(c)
+}
+
 type externalSshClient struct {
+	transports.Exec
 	sshcmd    []string
-	execCmd   *exec.Cmd
 	locations []string
 }
 
@@ -78,58 +94,13 @@ func (c *externalSshClient) Run() (stdin io.Writer, stdout io.Reader, err error)
 		var err error
 		location, err = c.search()
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, fmt.Errorf("ssh error: %w", err)
 		}
 	}
 
-	c.execCmd = c.cmd("%v -stdserver", location)
-
-	var stderr io.Reader
-	if stdin, err = c.execCmd.StdinPipe(); err != nil {
-		return
-	}
-	if stdout, err = c.execCmd.StdoutPipe(); err != nil {
-		return
-	}
-	if stderr, err = c.execCmd.StderrPipe(); err != nil {
-		return
-	}
-
-	err = c.execCmd.Start()
+	stdin, stdout, err = c.Start(c.cmd("%v -stdserver", location))
 	if err != nil {
-		return
+		err = fmt.Errorf("ssh error: %w", err)
 	}
-
-	go c.logerr(stderr)
 	return
 }
-
-func (c *externalSshClient) Close() error {
-	if c.execCmd == nil {
-		return nil
-	}
-	if c.execCmd.Process != nil {
-		err := c.execCmd.Process.Kill()
-		if err != nil {
-			return err
-		}
-	}
-
-	return c.execCmd.Wait()
-}
-
-// separate goroutine
-func (c *externalSshClient) logerr(stderr io.Reader) {
-	reader := bufio.NewReader(stderr)
-	var err error
-
-	for err == nil {
-		var line string
-		line, err = reader.ReadString('\n')
-		line = strings.TrimSpace(line)
-
-		if line != "" {
-			log.Warnln("Server Says:", line)
-		}
-	}
-}
@@ -7,15 +7,45 @@ import (
 	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 	"unisync/config"
 	"unisync/log"
 	"unisync/pageant"
+	"unisync/transports"
 
 	"golang.org/x/crypto/ssh"
 )
 
+func init() {
+	transports.Register("internalssh", &transports.Method{
+		New: func(conf *config.Config) (transports.Transport, error) {
+			return New(conf)
+		},
+		Validate: validate,
+		Target:   transports.SshTarget,
+	})
+}
+
+func validate(c *config.Config) error {
+	if err := transports.ValidateSsh(c); err != nil {
+		return err
+	}
+
+	if len(c.SshKeys) == 0 {
+		options := []string{"id_rsa", "id_ecdsa", "id_ed25519", "id_dsa", "identity"}
+		for _, option := range options {
+			option = filepath.Join(config.HomeDir(), ".ssh", option)
+			if config.IsFile(option) {
+				c.SshKeys = append(c.SshKeys, option)
+			}
+		}
+	}
+
+	return nil
+}
+
 type internalSshClient struct {
 	ssh       *ssh.Client
 	locations []string
@@ -120,13 +150,14 @@ func (c *internalSshClient) Run() (stdin io.Writer, stdout io.Reader, err error)
 		var err error
 		location, err = c.search()
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, fmt.Errorf("ssh error: %w", err)
 		}
 	}
 
 	var session *ssh.Session
 	session, err = c.ssh.NewSession()
 	if err != nil {
+		err = fmt.Errorf("ssh error: %w", err)
 		return
 	}
 
@@ -143,6 +174,7 @@ func (c *internalSshClient) Run() (stdin io.Writer, stdout io.Reader, err error)
 
 	err = session.Start(fmt.Sprintf("%v -stdserver", location))
 	if err != nil {
+		err = fmt.Errorf("ssh error: %w", err)
 		return
 	}
 
@@ -0,0 +1,90 @@
+package netclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"unisync/config"
+	"unisync/transports"
+)
+
+func init() {
+	transports.Register("tcp", &transports.Method{
+		New:      newTransport,
+		Validate: validateTcp,
+		Target:   transports.HostPortTarget,
+	})
+	transports.Register("unix", &transports.Method{
+		New:      newTransport,
+		Validate: validateUnix,
+		Target: func(c *config.Config) string {
+			return c.Socket
+		},
+	})
+}
+
+func validateTcp(c *config.Config) error {
+	if c.Port == 0 {
+		return config.SettingMissing("port")
+	}
+	if c.Host == "" {
+		c.Host = "127.0.0.1"
+	}
+	return nil
+}
+
+func validateUnix(c *config.Config) error {
+	var err error
+	if c.Socket == "" {
+		return config.SettingMissing("socket")
+	}
+	c.Socket, err = config.ResolvePath(c.Socket)
+	return err
+}
+
+func newTransport(conf *config.Config) (transports.Transport, error) {
+	return New(conf), nil
+}
+
+// plain, unencrypted connection to a server started with -server tcp:... or -server unix:...
+type netClient struct {
+	dialer  *net.Dialer
+	network string
+	addr    string
+	conn    net.Conn
+}
+
+func New(conf *config.Config) *netClient {
+	c := &netClient{
+		dialer: &net.Dialer{
+			Timeout:   conf.ConnectTimeout,
+			KeepAlive: conf.Timeout,
+		},
+		network: conf.Method,
+	}
+
+	if conf.Method == "unix" {
+		c.addr = conf.Socket
+	} else {
+		c.addr = fmt.Sprintf("%v:%v", conf.Host, conf.Port)
+	}
+
+	return c
+}
+
+func (c *netClient) Run() (io.Writer, io.Reader, error) {
+	var err error
+	c.conn, err = c.dialer.Dial(c.network, c.addr)
+	return c.conn, c.conn, err
+}
+
+func (c *netClient) Close() error {
+	// the heartbeat might have closed it already
+	if c.conn != nil {
+		if err := c.conn.Close(); !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,14 +1,86 @@
 package tlsclient
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
+	"path/filepath"
+	"strings"
 	"unisync/config"
+	"unisync/log"
+	"unisync/minica"
+	"unisync/transports"
 )
 
+func init() {
+	transports.Register("directtls", &transports.Method{
+		New:      newTransport,
+		Validate: validate,
+		Target:   transports.HostPortTarget,
+	})
+}
+
+func validate(c *config.Config) error {
+	if c.Host == "" {
+		return config.SettingMissing("host")
+	}
+	if c.Port == 0 {
+		return config.SettingMissing("port")
+	}
+	if c.Token != "" {
+		// with token auth there is no shared secure.key, so we pin the server's certificate instead
+		if c.TlsFingerprint == "" {
+			return fmt.Errorf("setting tls_fingerprint is required when token is set")
+		}
+		c.TlsFingerprint = strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(c.TlsFingerprint, "sha256:"), ":", ""))
+	}
+	return nil
+}
+
+func newTransport(conf *config.Config) (transports.Transport, error) {
+	if conf.Token != "" {
+		return New(conf, nil, nil), nil
+	}
+
+	mca, err := LoadKey(conf.TlsKey, false)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := mca.GetCert()
+	if err != nil {
+		return nil, err
+	}
+
+	return New(conf, cert, mca.GetCAPool()), nil
+}
+
+// loads the shared key, relative paths are in the config dir
+// the server can make a new one, the client needs to be given a copy
+func LoadKey(keyPath string, canMake bool) (*minica.MiniCA, error) {
+	if !filepath.IsAbs(keyPath) {
+		keyPath = filepath.Join(config.ConfigDir(), keyPath)
+	}
+
+	mca, err := minica.Load(keyPath)
+	if err != nil && canMake && errors.Is(err, fs.ErrNotExist) {
+		mca, err = minica.New(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create key at %v: %w", keyPath, err)
+		}
+
+		log.Printf("Created new key at %v, make sure to copy this to the client so it can connect!", keyPath)
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to load key at %v: %w", keyPath, err)
+	}
+
+	return mca, nil
+}
+
 type tlsClient struct {
 	dialer *tls.Dialer
 	host   string
@@ -16,16 +88,27 @@ type tlsClient struct {
 }
 
 func New(conf *config.Config, cert []tls.Certificate, capool *x509.CertPool) *tlsClient {
+	tlsConfig := &tls.Config{
+		ServerName:   "unisync",
+		Certificates: cert,
+		RootCAs:      capool,
+	}
+
+	if conf.TlsFingerprint != "" {
+		// we don't have the CA, so skip the normal verification and do our own
+		fingerprint := conf.TlsFingerprint
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyFingerprint(rawCerts, fingerprint)
+		}
+	}
+
 	dialer := &tls.Dialer{
 		NetDialer: &net.Dialer{
 			Timeout:   conf.ConnectTimeout,
 			KeepAlive: conf.Timeout,
 		},
-		Config: &tls.Config{
-			ServerName:   "unisync",
-			Certificates: cert,
-			RootCAs:      capool,
-		},
+		Config: tlsConfig,
 	}
 
 	return &tlsClient{
@@ -35,6 +118,43 @@ func New(conf *config.Config, cert []tls.Certificate, capool *x509.CertPool) *tl
 
 }
 
+// the pinned cert can be the server cert itself, or the CA that signed it
+func verifyFingerprint(rawCerts [][]byte, fingerprint string) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("server sent no certificate")
+	}
+
+	leaf, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return err
+	}
+
+	for i, raw := range rawCerts {
+		if fmt.Sprintf("%x", sha256.Sum256(raw)) != fingerprint {
+			continue
+		}
+		if i == 0 {
+			return nil
+		}
+
+		ca, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		pool.AddCert(ca)
+		_, err = leaf.Verify(x509.VerifyOptions{
+			DNSName:   "unisync",
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		return err
+	}
+
+	return fmt.Errorf("server certificate does not match tls_fingerprint")
+}
+
 func (t *tlsClient) Run() (io.Writer, io.Reader, error) {
 	var err error
 	t.conn, err = t.dialer.Dial("tcp", t.host)
@@ -42,8 +162,11 @@ func (t *tlsClient) Run() (io.Writer, io.Reader, error) {
 }
 
 func (t *tlsClient) Close() error {
+	// the heartbeat might have closed it already
 	if t.conn != nil {
-		return t.conn.Close()
+		if err := t.conn.Close(); !errors.Is(err, net.ErrClosed) {
+			return err
+		}
 	}
 	return nil
 }
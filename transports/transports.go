@@ -0,0 +1,74 @@
+package transports
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"unisync/config"
+)
+
+// a Transport gets us a pipe to a unisync server
+// New() shouldn't connect yet, that happens in Run()
+type Transport interface {
+	Run() (stdin io.Writer, stdout io.Reader, err error)
+	Close() error
+}
+
+type Method struct {
+	// creates the Transport for a config that has already passed Validate()
+	New func(*config.Config) (Transport, error)
+
+	// checks the settings this method uses, and fills in their defaults
+	// can be nil if the method has no settings of its own
+	Validate func(*config.Config) error
+
+	// where we're connecting to, for log messages (e.g. user@host)
+	Target func(*config.Config) string
+}
+
+var lock sync.Mutex
+var methods = map[string]*Method{}
+
+// transports register themselves in init(), and code that embeds unisync
+// can register its own before parsing any config with that method
+func Register(name string, m *Method) {
+	if m.New == nil {
+		panic("transports.Register(" + name + ") -- New can't be nil")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, exists := methods[name]; exists {
+		panic("transports.Register(" + name + ") -- already registered")
+	}
+	methods[name] = m
+	config.RegisterMethod(name, m.Validate)
+}
+
+func get(name string) (*Method, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	m, ok := methods[name]
+	if !ok {
+		return nil, fmt.Errorf("method %v is not available", name)
+	}
+	return m, nil
+}
+
+func New(conf *config.Config) (Transport, error) {
+	m, err := get(conf.Method)
+	if err != nil {
+		return nil, err
+	}
+	return m.New(conf)
+}
+
+func Target(conf *config.Config) string {
+	m, err := get(conf.Method)
+	if err != nil || m.Target == nil {
+		return conf.Host
+	}
+	return m.Target(conf)
+}
@@ -0,0 +1,34 @@
+package transports
+
+import (
+	"fmt"
+	"unisync/config"
+)
+
+// settings shared by ssh and internalssh
+func ValidateSsh(c *config.Config) error {
+	if c.Port == 0 {
+		c.Port = 22
+	}
+	if c.User == "" {
+		return config.SettingMissing("user")
+	}
+	if c.Host == "" {
+		return config.SettingMissing("host")
+	}
+	for _, sshkey := range c.SshKeys {
+		if !config.IsFile(sshkey) {
+			return fmt.Errorf("ssh_key=%v <-- file does not exist", sshkey)
+		}
+	}
+
+	return nil
+}
+
+func SshTarget(c *config.Config) string {
+	return fmt.Sprintf("%v@%v", c.User, c.Host)
+}
+
+func HostPortTarget(c *config.Config) string {
+	return fmt.Sprintf("%v:%v", c.Host, c.Port)
+}
@@ -1,56 +1,109 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"errors"
 	"flag"
 	"fmt"
-	"io/fs"
 	"os"
-	"path/filepath"
 	"runtime/debug"
+	"strings"
 	"unisync/background"
 	"unisync/config"
 	"unisync/log"
-	"unisync/minica"
+	"unisync/metrics"
+	"unisync/server"
+	"unisync/service"
 	"unisync/watcher"
 )
 
-var mca *minica.MiniCA
-
 func main() {
 	startFlag := flag.Bool("start", false, "start in background mode")
 	stopFlag := flag.Bool("stop", false, "stop in background mode")
 	stopAllFlag := flag.Bool("stopall", false, "stop all background instances")
-	statusFlag := flag.Bool("status", false, "list instances running in background mode")
+	statusFlag := flag.Bool("status", false, "list instances running in background mode, or show details for one")
+	syncNowFlag := flag.Bool("syncnow", false, "tell a running instance to sync right away")
+	pauseFlag := flag.Bool("pause", false, "tell a running instance to stop syncing until -resume")
+	resumeFlag := flag.Bool("resume", false, "tell a paused instance to sync and carry on")
+	bwlimitFlag := flag.String("bwlimit", "", "tell a running instance to limit transfers to UP:DOWN KB/s (0 for no limit)")
+	installServiceFlag := flag.Bool("install-service", false, "run as a systemd (linux) or launchd (macOS) service that starts on login")
+	uninstallServiceFlag := flag.Bool("uninstall-service", false, "stop and remove a service made with -install-service")
 
 	versionFlag := flag.Bool("version", false, "show version and exit")
 	debugFlag := flag.Bool("debug", false, "debug mode")
+	traceFlag := flag.Bool("trace", false, "log every command sent and received")
+	onceFlag := flag.Bool("once", false, "sync once and exit, with an exit code that tells what happened")
+	pushOnlyFlag := flag.Bool("push-only", false, "only copy changes from local to remote")
+	pullOnlyFlag := flag.Bool("pull-only", false, "only copy changes from remote to local")
+	localFlag := flag.String("local", "", "the local folder, instead of the config's local")
+	remoteFlag := flag.String("remote", "", "the remote folder as [[user@]host:]path, instead of the config's remote")
+	setFlags := stringsFlag{}
+	flag.Var(&setFlags, "set", "a key=value setting, on top of the config's (can be repeated)")
 	stdServerFlag := flag.Bool("stdserver", false, "run server that uses stdin/stdout (internal use only)")
 	serverFlag := flag.String("server", "", "run server")
+	tokensFlag := flag.String("tokens", "", "with -server, also accept clients with a token listed in this file")
+	allowHooksFlag := flag.Bool("allow-hooks", false, "with -server, run hook_post_sync_remote and on_change for clients that ask")
+	metricsListenFlag := flag.String("metrics-listen", "", "with -server, serve OpenMetrics at this [host]:port")
+	hashTokenFlag := flag.String("hashtoken", "", "print the hash of a token, for use in a -tokens file")
 	flag.Parse()
 	args := flag.Args()
 	var conf *config.Config
 
+	// inside a project, its .unisync.conf is the config to use (but -status alone still lists everything)
+	if len(args) == 0 && *localFlag == "" && *remoteFlag == "" && !*statusFlag {
+		if path := config.FindProjectHere(); path != "" {
+			args = []string{path}
+		}
+	}
+
 	if *versionFlag {
 		fmt.Println("git revision:", gitRevision())
 		fmt.Println("watcher:", watcher.Strategy)
 		os.Exit(0)
 	}
 
-	if *statusFlag {
-		running := background.ListRunning()
+	if *hashTokenFlag != "" {
+		fmt.Println(server.HashToken(*hashTokenFlag))
+		os.Exit(0)
+	}
 
-		if len(running) == 0 {
-			fmt.Println("There are no background instances running.")
-		} else {
-			fmt.Println("Background instances running:")
-			for _, name := range running {
-				fmt.Println(name)
+	if *statusFlag {
+		if len(args) == 1 {
+			if err := showStatus(args[0]); err != nil {
+				log.Fatalln(err)
 			}
+		} else {
+			showRunning()
+		}
+		os.Exit(0)
+	}
+	// these talk to an instance that's already running, without a config they'd start a new one instead
+	if (*syncNowFlag || *pauseFlag || *resumeFlag || *bwlimitFlag != "") && len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "-syncnow, -pause, -resume and -bwlimit need the config of a running instance")
+		os.Exit(2)
+	}
+	if *syncNowFlag || *pauseFlag || *resumeFlag {
+		cmd := "sync-now"
+		if *pauseFlag {
+			cmd = "pause"
+		} else if *resumeFlag {
+			cmd = "resume"
 		}
 
+		if err := sendControl(args[0], cmd); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+	if *bwlimitFlag != "" {
+		if err := sendBwlimit(args[0], *bwlimitFlag); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+	if *uninstallServiceFlag && len(args) == 1 {
+		// the config might already be gone, so don't parse it
+		if err := service.Uninstall(config.NameOf(args[0])); err != nil {
+			log.Fatalln(err)
+		}
 		os.Exit(0)
 	}
 	if *stopAllFlag {
@@ -68,16 +121,35 @@ func main() {
 		os.Exit(0)
 	}
 	if *serverFlag != "" {
-		err := runDirectServer(*serverFlag)
+		if *metricsListenFlag != "" {
+			if err := metrics.Serve(*metricsListenFlag); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		err := runDirectServer(*serverFlag, *tokensFlag, *allowHooksFlag)
 		if err != nil {
 			log.Fatalln(err)
 		}
 		os.Exit(0)
 	}
 
-	if len(args) == 1 {
+	settings := []string{}
+	if *localFlag != "" {
+		settings = append(settings, "local="+*localFlag)
+	}
+	if *remoteFlag != "" {
+		settings = append(settings, config.RemoteSettings(*remoteFlag)...)
+	}
+	settings = append(settings, setFlags...)
+
+	if len(args) == 1 || (len(args) == 0 && len(settings) > 0) {
+		path := ""
+		if len(args) == 1 {
+			path = args[0]
+		}
+
 		var err error
-		conf, err = config.Parse(args[0])
+		conf, err = config.Parse(path, settings...)
 		if err != nil {
 			log.Fatalln(err)
 		}
@@ -85,6 +157,11 @@ func main() {
 		showHelp()
 	}
 
+	// pid files, services and the control socket all go by name
+	if conf.Name == "" && (*startFlag || *stopFlag || *installServiceFlag) {
+		log.Fatalln("-start, -stop and -install-service need a config file")
+	}
+
 	if background.IsChild() {
 		err := background.WritePid(conf.Name)
 		if err != nil {
@@ -92,6 +169,13 @@ func main() {
 		}
 	}
 
+	if *installServiceFlag {
+		if err := service.Install(conf.Name, config.Find(args[0])); err != nil {
+			log.Fatalln(err)
+		}
+		os.Exit(0)
+	}
+
 	if *startFlag && !background.IsChild() {
 		err := background.Start(conf.Name)
 		if err != nil {
@@ -111,48 +195,60 @@ func main() {
 		if *debugFlag {
 			conf.Debug = true
 		}
+		if *traceFlag {
+			conf.LogTrace = true
+		}
+		if *onceFlag {
+			conf.WatchLocal = "0"
+			conf.WatchRemote = "0"
+		}
+		if *pushOnlyFlag && *pullOnlyFlag {
+			log.Fatalln("-push-only and -pull-only can't be used together")
+		} else if *pushOnlyFlag {
+			conf.Direction = "push"
+		} else if *pullOnlyFlag {
+			conf.Direction = "pull"
+		}
 		if conf.Debug {
 			log.ScreenLevel = log.Debug
 		}
+		log.Session = conf.Name
+		log.ScreenFormat = conf.LogFormat
+		log.ScreenTrace = conf.LogTrace
 		if conf.Log != "" {
-			err := log.AddFile(conf.Log, log.ScreenLevel, "2006-01-02 15:04:05")
+			// log_level is only for the file, the screen follows debug
+			level := log.ScreenLevel
+			if conf.LogLevel != "" {
+				level, _ = log.ParseLevel(conf.LogLevel)
+			}
+
+			rotation := log.Rotation{
+				MaxSize:  int64(conf.LogMaxSize) * 1024 * 1024,
+				MaxFiles: conf.LogMaxFiles,
+				Compress: conf.LogCompress,
+			}
+			output, err := log.AddFile(conf.Log, level, "2006-01-02 15:04:05", rotation)
 			if err != nil {
 				log.Fatalf("Unable to open file for logging: %v", err)
 			}
+			output.Format = conf.LogFormat
+			output.Trace = conf.LogTrace
 		}
 
-		runClient(conf)
+		os.Exit(runClient(conf))
 	}
 }
 
-func getCert(keyPath string, canMake bool) ([]tls.Certificate, *x509.CertPool, error) {
-	if mca == nil {
-		var err error
-
-		if !filepath.IsAbs(keyPath) {
-			keyPath = filepath.Join(config.ConfigDir(), keyPath)
-		}
-
-		mca, err = minica.Load(keyPath)
-
-		if err != nil && canMake && errors.Is(err, fs.ErrNotExist) {
-			mca, err = minica.New(keyPath)
-			if err != nil {
-				return nil, nil, fmt.Errorf("Failed to create key at %v: %w", keyPath, err)
-			}
+// a flag that can be given several times
+type stringsFlag []string
 
-			log.Printf("Created new key at %v, make sure to copy this to the client so it can connect!", keyPath)
-		} else if err != nil {
-			return nil, nil, fmt.Errorf("Failed to load key at %v: %w", keyPath, err)
-		}
-	}
-
-	cert, err := mca.GetCert()
-	if err != nil {
-		return nil, nil, err
-	}
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
 
-	return cert, mca.GetCAPool(), nil
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
 
 func gitRevision() string {
@@ -3,7 +3,9 @@ package watcher
 import (
 	"sync"
 	"time"
+	"unisync/filelist"
 	"unisync/gitignore"
+	"unisync/metrics"
 )
 
 type stopFn func()
@@ -12,6 +14,7 @@ type Watcher struct {
 	C        chan string
 	PollFreq time.Duration
 	enabled  bool
+	pending  int
 	ignore   []string
 	mutex    sync.Mutex
 	stop     stopFn
@@ -53,17 +56,31 @@ func (w *Watcher) Ready() {
 
 	w.drain()
 	w.enabled = true
+	w.pending = 0
+}
+
+// how many changes we've seen since the last Ready()
+func (w *Watcher) Pending() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.pending
 }
 
 func (w *Watcher) Send(path string) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	if !w.enabled {
+	if gitignore.MatchAny(w.ignore, path, true) {
+		return
+	}
+	// our own temp files come and go with every transfer
+	if filelist.IsTmpFile(path) {
 		return
 	}
 
-	if gitignore.MatchAny(w.ignore, path, true) {
+	w.pending++
+	// the sync this sets off will see it anyway, that's not a drop
+	if !w.enabled {
 		return
 	}
 
@@ -74,6 +91,7 @@ func (w *Watcher) Send(path string) {
 	select {
 	case w.C <- path:
 	default:
+		metrics.WatcherEventsDropped.Inc()
 	}
 }
 